@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"ranzhouol/k8s_study/inspur/karmada/util"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+// clusterConditionReady is the condition type telling if the member cluster is ready.
+const clusterConditionReady = "Ready"
+
+// clusterAPI serves the clusters registered in karmada control plane as JSON, the clusters are read from
+// the cluster cache.
+type clusterAPI struct {
+	clusterCache *util.ClusterCache
+	kubeClient   kubeclient.Interface
+	watchHub     *clusterWatchHub
+}
+
+// newClusterAPI builds the clients of karmada control plane from the kubeconfig.
+func newClusterAPI(configPath string) (*clusterAPI, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", configPath)
+	if err != nil {
+		return nil, err
+	}
+	karmadaClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubeclient.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	clusterCache := util.NewClusterCache(karmadaClient, 0)
+	return &clusterAPI{
+		clusterCache: clusterCache,
+		kubeClient:   kubeClient,
+		watchHub:     newClusterWatchHub(clusterCache.Informer()),
+	}, nil
+}
+
+// run fills the cluster cache and keeps it up to date until stopCh is closed.
+func (a *clusterAPI) run(stopCh <-chan struct{}) {
+	a.clusterCache.Run(stopCh)
+}
+
+// register adds the routes of the cluster inventory to the router.
+func (a *clusterAPI) register(r *mux.Router) {
+	r.HandleFunc("/clusters", a.listClusters).Methods("GET")
+	// registered before /clusters/{name}, so that it's not taken as a cluster name.
+	r.HandleFunc("/clusters/watch", a.watchClusters).Methods("GET")
+	r.HandleFunc("/clusters/{name}", a.getCluster).Methods("GET")
+	r.HandleFunc("/clusters/{name}/secrets/health", a.getClusterSecretsHealth).Methods("GET")
+}
+
+// clusterView is a cluster returned by the inventory, the status is summarized.
+type clusterView struct {
+	Name   string                      `json:"name"`
+	Labels map[string]string           `json:"labels,omitempty"`
+	Spec   clusterv1alpha1.ClusterSpec `json:"spec"`
+	Status clusterStatusSummary        `json:"status"`
+}
+
+// clusterStatusSummary is the part of the cluster status shown by the inventory.
+type clusterStatusSummary struct {
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// Ready is the status of the Ready condition, Unknown if the condition is not reported yet.
+	Ready       metav1.ConditionStatus `json:"ready"`
+	ReadyNodes  int32                  `json:"readyNodes"`
+	TotalNodes  int32                  `json:"totalNodes"`
+	Allocatable corev1.ResourceList    `json:"allocatable,omitempty"`
+}
+
+// clusterListView is a page of the clusters, Continue is passed back to get the next page.
+type clusterListView struct {
+	Items    []clusterView `json:"items"`
+	Continue string        `json:"continue,omitempty"`
+}
+
+func newClusterView(cluster *clusterv1alpha1.Cluster) clusterView {
+	view := clusterView{
+		Name:   cluster.Name,
+		Labels: cluster.Labels,
+		Spec:   cluster.Spec,
+		Status: clusterStatusSummary{
+			KubernetesVersion: cluster.Status.KubernetesVersion,
+			Ready:             metav1.ConditionUnknown,
+		},
+	}
+	if condition := meta.FindStatusCondition(cluster.Status.Conditions, clusterConditionReady); condition != nil {
+		view.Status.Ready = condition.Status
+	}
+	if summary := cluster.Status.NodeSummary; summary != nil {
+		view.Status.ReadyNodes = summary.ReadyNum
+		view.Status.TotalNodes = summary.TotalNum
+	}
+	if summary := cluster.Status.ResourceSummary; summary != nil {
+		view.Status.Allocatable = summary.Allocatable
+	}
+	return view
+}
+
+// listClusters serves a page of the clusters sorted by name. They are filtered by the labelSelector, id and
+// region query parameters, and paged by the limit and continue query parameters.
+func (a *clusterAPI) listClusters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid labelSelector %q, error: %v", query.Get("labelSelector"), err))
+		return
+	}
+	var limit int
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q, should be a positive integer", value))
+			return
+		}
+	}
+	// the continue token is the encoded name of the last cluster of the previous page.
+	after, err := base64.RawURLEncoding.DecodeString(query.Get("continue"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid continue token %q", query.Get("continue")))
+		return
+	}
+	if !a.clusterCache.HasSynced() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("clusters are not synced yet, retry later"))
+		return
+	}
+
+	var clusters []clusterv1alpha1.Cluster
+	switch {
+	case query.Get("id") != "":
+		clusters, err = a.clusterCache.ByID(query.Get("id"))
+	case query.Get("region") != "":
+		clusters, err = a.clusterCache.ByRegion(query.Get("region"))
+	default:
+		clusters, err = a.clusterCache.List(selector)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list := clusterListView{Items: []clusterView{}}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if cluster.Name <= string(after) || !selector.Matches(labels.Set(cluster.Labels)) {
+			continue
+		}
+		if query.Get("region") != "" && cluster.Spec.Region != query.Get("region") {
+			continue
+		}
+		if limit > 0 && len(list.Items) == limit {
+			list.Continue = base64.RawURLEncoding.EncodeToString([]byte(list.Items[limit-1].Name))
+			break
+		}
+		list.Items = append(list.Items, newClusterView(cluster))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getCluster serves the cluster with the name in the path.
+func (a *clusterAPI) getCluster(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := a.lookupCluster(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newClusterView(cluster))
+}
+
+// getClusterSecretsHealth checks the secrets referenced by the cluster with the name in the path.
+// Pull mode clusters keep no secret in karmada control plane, so there is nothing to check.
+func (a *clusterAPI) getClusterSecretsHealth(w http.ResponseWriter, r *http.Request) {
+	cluster, ok := a.lookupCluster(w, r)
+	if !ok {
+		return
+	}
+	if cluster.Spec.SyncMode == clusterv1alpha1.Pull {
+		writeError(w, http.StatusConflict, fmt.Errorf("cluster(%s) is in pull mode and has no secret in karmada control plane", cluster.Name))
+		return
+	}
+
+	diagnosis := util.DiagnoseClusterSecrets(r.Context(), a.kubeClient, cluster)
+	health := struct {
+		*util.ClusterDiagnosis
+		Healthy bool `json:"healthy"`
+	}{ClusterDiagnosis: diagnosis, Healthy: diagnosis.Healthy()}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// lookupCluster gets the cluster with the name in the path, the error is written to the response if it
+// can not be found.
+func (a *clusterAPI) lookupCluster(w http.ResponseWriter, r *http.Request) (*clusterv1alpha1.Cluster, bool) {
+	if !a.clusterCache.HasSynced() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("clusters are not synced yet, retry later"))
+		return nil, false
+	}
+	name := mux.Vars(r)["name"]
+	cluster, exist, err := a.clusterCache.Get(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !exist {
+		writeError(w, http.StatusNotFound, fmt.Errorf("cluster(%s) not found", name))
+		return nil, false
+	}
+	return cluster, true
+}
+
+// writeJSON writes obj as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		fmt.Println(err.Error())
+	}
+}
+
+// writeError writes err as a JSON body with the status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"ranzhouol/k8s_study/inspur/karmada/util"
+	"time"
+
+	"github.com/gorilla/mux"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// registeredClustersRefreshInterval is the interval to count the registered clusters again.
+const registeredClustersRefreshInterval = 30 * time.Second
+
+// statusRecorder remembers the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps the response streamed if the underlying writer supports it.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// unobservedRoutes are the long-lived streaming routes, whose connection time is not a request latency.
+var unobservedRoutes = map[string]bool{
+	"/clusters/watch": true,
+}
+
+// instrumentHandler observes the latency of the requests by route template, so that the path parameters
+// do not blow up the labels.
+func instrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		if unobservedRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		util.HTTPRequestDuration.WithLabelValues(route, r.Method, fmt.Sprint(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// refreshRegisteredClusters counts the clusters in the cluster cache.
+func refreshRegisteredClusters(clusterCache *util.ClusterCache) {
+	if !clusterCache.HasSynced() {
+		return
+	}
+	clusters, err := clusterCache.List(labels.Everything())
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	util.UpdateRegisteredClusters(clusters)
+}
@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"github.com/gorilla/mux"
 	tokenutil "github.com/karmada-io/karmada/pkg/karmadactl/util/bootstraptoken"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"net/http"
+	"ranzhouol/k8s_study/inspur/karmada/util"
 	"strings"
 	"time"
 )
 
+// karmadaConfigPath is the kubeconfig of karmada control plane where the tokens are created.
+var karmadaConfigPath = "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\4970\\karmada-apiserver.config"
+
+// auditLog records the tokens created through the http server.
+var auditLog = util.NewAuditLog(util.DefaultAuditLogPath)
+
+// requestSource identifies who requests a token in the audit log.
+var requestSource util.AuditRequestSource
+
 type CommandTokenOptions struct {
 	TTL                  *metav1.Duration // 令牌失效时间
 	Description          string
@@ -20,9 +33,30 @@ type CommandTokenOptions struct {
 	Usages               []string
 	PrintRegisterCommand bool
 	parentCommand        string // kubectl karmada 或 karmadactl
+
+	// Actor and SourceIP tell who requests the token in the audit log.
+	Actor    string
+	SourceIP string
 }
 
-func (o *CommandTokenOptions) runCreateToken(kubeconfig string, client kubeclient.Interface) (string, error) {
+func (o *CommandTokenOptions) runCreateToken(ctx context.Context, kubeconfig string, client kubeclient.Interface) (result string, err error) {
+	record := &util.AuditRecord{Operation: "create-token", Actor: o.Actor, SourceIP: o.SourceIP}
+	defer func() {
+		if err != nil {
+			util.TokensTotal.WithLabelValues(util.TokenResultFailed).Inc()
+		} else {
+			util.TokensTotal.WithLabelValues(util.TokenResultIssued).Inc()
+		}
+		record.Finish(err)
+		if auditErr := auditLog.Append(record); auditErr != nil {
+			fmt.Println(auditErr.Error())
+			// the token is not handed out if it can not be audited.
+			if err == nil {
+				result, err = "", auditErr
+			}
+		}
+	}()
+
 	fmt.Println("creating token")
 	bootstrapToken, err := tokenutil.GenerateRandomBootstrapToken(o.TTL, o.Description, o.Groups, o.Usages)
 	if err != nil {
@@ -30,12 +64,16 @@ func (o *CommandTokenOptions) runCreateToken(kubeconfig string, client kubeclien
 		return "", err
 	}
 
-	if err := tokenutil.CreateNewToken(client, bootstrapToken); err != nil {
+	// the secret is created here instead of by tokenutil.CreateNewToken, so that the request is canceled with ctx.
+	// a secret with the same token id already existing fails the create like it does there.
+	if _, err = client.CoreV1().Secrets(metav1.NamespaceSystem).Create(ctx, tokenutil.ConvertBootstrapTokenToSecret(bootstrapToken), metav1.CreateOptions{}); err != nil {
 		fmt.Println(err.Error())
 		return "", err
 	}
 
 	tokenStr := bootstrapToken.Token.ID + "." + bootstrapToken.Token.Secret
+	record.Objects = []string{util.AuditObject("Secret", metav1.NamespaceSystem, fmt.Sprintf("bootstrap-token-%s", bootstrapToken.Token.ID))}
+	record.Details = map[string]string{"token": util.RedactToken(tokenStr)}
 
 	// if --print-register-command was specified, print a machine-readable full `karmadactl register` command
 	// otherwise, just print the token
@@ -59,7 +97,7 @@ func GenerateRegisterCommand() {
 
 }
 
-func NewCmdTokenCreate(kubeconfig string, tokenOpts *CommandTokenOptions) (string, error) {
+func NewCmdTokenCreate(ctx context.Context, kubeconfig string, tokenOpts *CommandTokenOptions) (string, error) {
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		fmt.Println(err.Error())
@@ -72,13 +110,32 @@ func NewCmdTokenCreate(kubeconfig string, tokenOpts *CommandTokenOptions) (strin
 		return "", err
 	}
 
-	return tokenOpts.runCreateToken(kubeconfig, client)
+	return tokenOpts.runCreateToken(ctx, kubeconfig, client)
 
 }
 
 func main() {
+	auditLogPath := flag.String("audit-log", util.DefaultAuditLogPath, "path to the append-only audit log of the created tokens")
+	flag.StringVar(&karmadaConfigPath, "karmada-config", karmadaConfigPath, "path to the kubeconfig of karmada control plane")
+	trustedProxies := flag.String("trusted-proxies", "", "comma separated IPs or CIDRs of the proxies trusted to set X-Remote-User and X-Forwarded-For")
+	flag.Parse()
+	auditLog = util.NewAuditLog(*auditLogPath)
+	proxies, err := util.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		panic(err.Error())
+	}
+	requestSource = util.AuditRequestSource{TrustedProxies: proxies}
+	clusters, err := newClusterAPI(karmadaConfigPath)
+	if err != nil {
+		panic(err.Error())
+	}
+	go clusters.run(wait.NeverStop)
+	go wait.Forever(func() { refreshRegisteredClusters(clusters.clusterCache) }, registeredClustersRefreshInterval)
 
 	r := mux.NewRouter()
+	r.Use(instrumentHandler)
+	r.Handle("/metrics", util.MetricsHandler()).Methods("GET")
+	clusters.register(r)
 	r.HandleFunc("/multicluster/cluster.karmada.io/v1alpha1/clusters/pull", HomeHandler).Methods("GET")
 	fmt.Println("http server starting at 3000 ...")
 	http.ListenAndServe(":3000", r)
@@ -98,11 +155,11 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 			PrintRegisterCommand: true,
 			parentCommand:        "kubectl karmada", // 或karmadactl
 		}
-		//kubeconfig := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\karmada-apiserver.config" //用不了
-		kubeconfig := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\4970\\karmada-apiserver.config"
-		command, err := NewCmdTokenCreate(kubeconfig, opts)
+		opts.Actor, opts.SourceIP = requestSource.Identify(r)
+		command, err := NewCmdTokenCreate(r.Context(), karmadaConfigPath, opts)
 		if err != nil {
 			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 		_, err = w.Write([]byte(command))
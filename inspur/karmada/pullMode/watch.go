@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"ranzhouol/k8s_study/inspur/karmada/util"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+const (
+	// clusterWatchHeartbeatInterval is the interval of the comments sent to keep idle streams open.
+	clusterWatchHeartbeatInterval = 15 * time.Second
+	// clusterWatchHistorySize is the number of the latest events kept for the clients resuming a stream.
+	clusterWatchHistorySize = 1000
+	// clusterWatchBufferSize is the number of the events buffered for a client, a client falling further
+	// behind is disconnected and resumes with the last event ID.
+	clusterWatchBufferSize = 100
+)
+
+// errResourceVersionExpired is returned when the resource version to resume from is no longer kept.
+var errResourceVersionExpired = errors.New("resource version is too old or unknown, watch again without it")
+
+// clusterEvent is a change of a cluster seen by the informer. OldObject is only set for a modification.
+type clusterEvent struct {
+	Type            watch.EventType
+	ResourceVersion string
+	Object          *clusterv1alpha1.Cluster
+	OldObject       *clusterv1alpha1.Cluster
+}
+
+// clusterWatchHub fans the events of one cluster informer out to all the streaming clients, and keeps the
+// latest events so that a client can resume from the resource version it has seen.
+type clusterWatchHub struct {
+	informer cache.SharedIndexInformer
+
+	mu          sync.Mutex
+	objects     map[string]*clusterv1alpha1.Cluster
+	history     []clusterEvent
+	subscribers map[*clusterSubscriber]struct{}
+}
+
+// clusterSubscriber receives the events of the hub, events is closed if the client falls behind.
+type clusterSubscriber struct {
+	events chan clusterEvent
+}
+
+func newClusterWatchHub(informer cache.SharedIndexInformer) *clusterWatchHub {
+	hub := &clusterWatchHub{
+		informer:    informer,
+		objects:     map[string]*clusterv1alpha1.Cluster{},
+		subscribers: map[*clusterSubscriber]struct{}{},
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			hub.handle(watch.Added, obj, nil)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			hub.handle(watch.Modified, newObj, oldObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			hub.handle(watch.Deleted, obj, nil)
+		},
+	})
+	return hub
+}
+
+// hasSynced tells if the informer has listed all the clusters.
+func (h *clusterWatchHub) hasSynced() bool {
+	return h.informer.HasSynced()
+}
+
+func (h *clusterWatchHub) handle(eventType watch.EventType, obj, oldObj interface{}) {
+	cluster, err := util.ConvertToCluster(obj)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	event := clusterEvent{Type: eventType, ResourceVersion: cluster.ResourceVersion, Object: cluster}
+	if oldObj != nil {
+		if event.OldObject, err = util.ConvertToCluster(oldObj); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		// the informer relists the unchanged clusters as updates.
+		if event.OldObject.ResourceVersion == cluster.ResourceVersion {
+			return
+		}
+	}
+	h.publish(event)
+}
+
+// publish records the event and sends it to the subscribers, the ones whose buffer is full are dropped.
+func (h *clusterWatchHub) publish(event clusterEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if event.Type == watch.Deleted {
+		delete(h.objects, event.Object.Name)
+	} else {
+		h.objects[event.Object.Name] = event.Object
+	}
+	h.history = append(h.history, event)
+	if len(h.history) > clusterWatchHistorySize {
+		h.history = h.history[len(h.history)-clusterWatchHistorySize:]
+	}
+
+	for subscriber := range h.subscribers {
+		select {
+		case subscriber.events <- event:
+		default:
+			close(subscriber.events)
+			delete(h.subscribers, subscriber)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the events to replay before the ones it receives. Without a
+// resource version, every current cluster is replayed as added. With one, the events after it are replayed.
+func (h *clusterWatchHub) subscribe(resourceVersion string) (*clusterSubscriber, []clusterEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []clusterEvent
+	if resourceVersion == "" {
+		head := ""
+		if len(h.history) > 0 {
+			head = h.history[len(h.history)-1].ResourceVersion
+		}
+		for _, cluster := range h.objects {
+			// the snapshot is positioned at the latest event, so that a client resumes after it.
+			replay = append(replay, clusterEvent{Type: watch.Added, ResourceVersion: head, Object: cluster})
+		}
+		sort.Slice(replay, func(i, j int) bool { return replay[i].Object.Name < replay[j].Object.Name })
+	} else {
+		index := -1
+		for i := len(h.history) - 1; i >= 0; i-- {
+			if h.history[i].ResourceVersion == resourceVersion {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, nil, errResourceVersionExpired
+		}
+		replay = append(replay, h.history[index+1:]...)
+	}
+
+	subscriber := &clusterSubscriber{events: make(chan clusterEvent, clusterWatchBufferSize)}
+	h.subscribers[subscriber] = struct{}{}
+	return subscriber, replay, nil
+}
+
+// unsubscribe removes the subscriber if it's not dropped yet.
+func (h *clusterWatchHub) unsubscribe(subscriber *clusterSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[subscriber]; ok {
+		close(subscriber.events)
+		delete(h.subscribers, subscriber)
+	}
+}
+
+// clusterWatchFilter selects the clusters streamed to a client.
+type clusterWatchFilter struct {
+	selector labels.Selector
+	syncMode clusterv1alpha1.ClusterSyncMode
+}
+
+// newClusterWatchFilter parses the labelSelector and syncMode query parameters.
+func newClusterWatchFilter(labelSelector, syncMode string) (*clusterWatchFilter, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid labelSelector %q, error: %v", labelSelector, err)
+	}
+	mode := clusterv1alpha1.ClusterSyncMode(syncMode)
+	if mode != "" && mode != clusterv1alpha1.Push && mode != clusterv1alpha1.Pull {
+		return nil, fmt.Errorf("invalid syncMode %q, should be %s or %s", syncMode, clusterv1alpha1.Push, clusterv1alpha1.Pull)
+	}
+	return &clusterWatchFilter{selector: selector, syncMode: mode}, nil
+}
+
+func (f *clusterWatchFilter) matches(cluster *clusterv1alpha1.Cluster) bool {
+	if f.syncMode != "" && cluster.Spec.SyncMode != f.syncMode {
+		return false
+	}
+	return f.selector.Matches(labels.Set(cluster.Labels))
+}
+
+// eventType returns the type of the event seen by the client, a cluster modified into or out of the filter
+// is seen as added or deleted. False is returned if the client does not see the event.
+func (f *clusterWatchFilter) eventType(event clusterEvent) (watch.EventType, bool) {
+	matched := f.matches(event.Object)
+	if event.Type != watch.Modified {
+		return event.Type, matched
+	}
+	switch oldMatched := f.matches(event.OldObject); {
+	case oldMatched && matched:
+		return watch.Modified, true
+	case matched:
+		return watch.Added, true
+	case oldMatched:
+		return watch.Deleted, true
+	}
+	return "", false
+}
+
+// watchClusters streams the changes of the clusters as Server-Sent Events. The stream resumes after the
+// resourceVersion query parameter or the Last-Event-ID header, and is filtered by the labelSelector and
+// syncMode query parameters.
+func (a *clusterAPI) watchClusters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := newClusterWatchFilter(query.Get("labelSelector"), query.Get("syncMode"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	if !a.watchHub.hasSynced() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("clusters are not synced yet, retry later"))
+		return
+	}
+
+	resourceVersion := query.Get("resourceVersion")
+	if resourceVersion == "" {
+		resourceVersion = r.Header.Get("Last-Event-ID")
+	}
+	subscriber, replay, err := a.watchHub.subscribe(resourceVersion)
+	if err != nil {
+		writeError(w, http.StatusGone, err)
+		return
+	}
+	defer a.watchHub.unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range replay {
+		if err = writeClusterEvent(w, filter, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(clusterWatchHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err = io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscriber.events:
+			if !ok {
+				// the client falls behind, it reconnects with the last event ID.
+				return
+			}
+			if err = writeClusterEvent(w, filter, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeClusterEvent writes the event as a Server-Sent Event if the client sees it. The event ID is the
+// resource version to resume from.
+func writeClusterEvent(w io.Writer, filter *clusterWatchFilter, event clusterEvent) error {
+	eventType, ok := filter.eventType(event)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		Type   watch.EventType `json:"type"`
+		Object clusterView     `json:"object"`
+	}{Type: eventType, Object: newClusterView(event.Object)})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ResourceVersion, eventType, data)
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+	names2 "ranzhouol/k8s_study/inspur/karmada/util/names"
+)
+
+// auditLogPath is the path of the audit log, set by --audit-log of every command.
+var auditLogPath = util2.DefaultAuditLogPath
+
+// recordAudit appends the record of a state changing operation finished with err to the audit log, and
+// returns err. An operation succeeded but failed to be audited is reported as an error.
+func recordAudit(record *util2.AuditRecord, err error) error {
+	record.Actor = util2.AuditActor()
+	record.Finish(err)
+	if auditErr := util2.NewAuditLog(auditLogPath).Append(record); auditErr != nil {
+		if err == nil {
+			return auditErr
+		}
+		logrus.Error(auditErr)
+	}
+	return err
+}
+
+// joinAuditObjects returns the objects touched by join in both clusters.
+func joinAuditObjects(opts util2.ClusterRegisterOption) []string {
+	objects := newMemberClusterObjects(opts)
+	auditObjects := []string{
+		util2.AuditObject("Namespace", "", opts.ClusterNamespace),
+		util2.AuditObject("ServiceAccount", objects.serviceAccount.Namespace, objects.serviceAccount.Name),
+		util2.AuditObject("ServiceAccount", objects.impersonationSA.Namespace, objects.impersonationSA.Name),
+		util2.AuditObject("ClusterRole", "", objects.clusterRole.Name),
+		util2.AuditObject("ClusterRoleBinding", "", objects.clusterRoleBinding.Name),
+	}
+	if opts.IsKubeCredentialsEnabled() {
+		auditObjects = append(auditObjects, util2.AuditObject("Secret", opts.ClusterNamespace, opts.ClusterName))
+	}
+	if opts.IsKubeImpersonatorEnabled() {
+		auditObjects = append(auditObjects, util2.AuditObject("Secret", opts.ClusterNamespace, names2.GenerateImpersonationSecretName(opts.ClusterName)))
+	}
+	return append(auditObjects, util2.AuditObject("Cluster", "", opts.ClusterName))
+}
+
+// clusterSecretAuditObjects returns the secrets referenced by the cluster.
+func clusterSecretAuditObjects(cluster *clusterv1alpha1.Cluster) []string {
+	var auditObjects []string
+	for _, ref := range []*clusterv1alpha1.LocalSecretReference{cluster.Spec.SecretRef, cluster.Spec.ImpersonatorSecretRef} {
+		if ref != nil {
+			auditObjects = append(auditObjects, util2.AuditObject("Secret", ref.Namespace, ref.Name))
+		}
+	}
+	return auditObjects
+}
+
+// runVerify checks the hash chain of the audit log.
+func runVerify(args []string) error {
+	flags, _, _ := newCommandFlagSet("verify")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	count, err := util2.VerifyAuditLog(auditLogPath)
+	if err != nil {
+		return fmt.Errorf("audit log %s is tampered after %d valid records: %v", auditLogPath, count, err)
+	}
+	fmt.Printf("audit log %s is intact, %d records verified\n", auditLogPath, count)
+	return nil
+}
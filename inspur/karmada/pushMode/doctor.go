@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+// diagnoseClusters diagnoses the connectivity and credentials of every push mode cluster registered in control plane.
+// If recordEvents is true, an event is recorded against the clusters whose health changed.
+func diagnoseClusters(ctx context.Context, controlPlaneRestConfig *rest.Config, timeout time.Duration, recordEvents bool) ([]*util2.ClusterDiagnosis, error) {
+	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(controlPlaneRestConfig)
+	karmadaClient, err := dynamic.NewForConfig(controlPlaneRestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := util2.ListClusters(ctx, karmadaClient)
+	if err != nil {
+		return nil, err
+	}
+	util2.UpdateRegisteredClusters(clusters)
+
+	var diagnoses []*util2.ClusterDiagnosis
+	for i := range clusters {
+		cluster := &clusters[i]
+		// pull mode clusters are not reached by control plane.
+		if cluster.Spec.SyncMode != clusterv1alpha1.Push {
+			logrus.Infof("skip cluster(%s) as it is in %s mode", cluster.Name, cluster.Spec.SyncMode)
+			continue
+		}
+		diagnosis := util2.DiagnoseCluster(ctx, controlPlaneKubeClient, cluster, timeout)
+		if recordEvents {
+			if err = recordHealthChange(ctx, controlPlaneKubeClient, cluster, diagnosis); err != nil {
+				logrus.Warn(err)
+			}
+		}
+		diagnoses = append(diagnoses, diagnosis)
+	}
+	return diagnoses, nil
+}
+
+// recordHealthChange records an event against the cluster if its health differs from the last recorded one.
+func recordHealthChange(ctx context.Context, controlPlaneKubeClient kubeclient.Interface, cluster *clusterv1alpha1.Cluster, diagnosis *util2.ClusterDiagnosis) error {
+	lastReason, err := util2.LatestClusterEventReason(ctx, controlPlaneKubeClient, cluster.Name,
+		util2.EventReasonClusterHealthy, util2.EventReasonClusterUnhealthy)
+	if err != nil {
+		return err
+	}
+
+	eventType, reason, message := corev1.EventTypeNormal, util2.EventReasonClusterHealthy, "all checks passed"
+	if !diagnosis.Healthy() {
+		var failures []string
+		for _, check := range diagnosis.Checks {
+			if !check.Passed {
+				failures = append(failures, fmt.Sprintf("%s: %s", check.Name, check.Message))
+			}
+		}
+		eventType, reason, message = corev1.EventTypeWarning, util2.EventReasonClusterUnhealthy, strings.Join(failures, "; ")
+	}
+	// a cluster never diagnosed before is only recorded when it's unhealthy.
+	if reason == lastReason || (lastReason == "" && diagnosis.Healthy()) {
+		return nil
+	}
+	return util2.RecordClusterEvent(ctx, controlPlaneKubeClient, cluster, eventType, reason, message)
+}
+
+// printDiagnoses writes the diagnoses to w as a table or JSON.
+func printDiagnoses(w io.Writer, diagnoses []*util2.ClusterDiagnosis, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diagnoses)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLUSTER\tCHECK\tRESULT\tREASON\tMESSAGE\tHINT")
+		for _, diagnosis := range diagnoses {
+			for _, check := range diagnosis.Checks {
+				result := "OK"
+				if !check.Passed {
+					result = "FAIL"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", diagnosis.Cluster, check.Name, result, check.Reason, check.Message, check.Hint)
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q, should be table or json", output)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyValueFlag is a flag.Value of key=value pairs, the pairs can be separated by comma or given by repeated flags.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) != 2 || keyValue[0] == "" {
+			return fmt.Errorf("invalid pair %q, should be key=value", pair)
+		}
+		f[keyValue[0]] = keyValue[1]
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+// metricsBindAddress is the address /metrics is served on, set by --metrics-bind-address of every command.
+var metricsBindAddress string
+
+// serveMetrics serves /metrics on address in background, so that long batch runs can be scraped.
+// The address is listened on before returning, so that a command with a bad address fails instead of running unobserved.
+func serveMetrics(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on metrics address %s, error: %v", address, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", util2.MetricsHandler())
+	logrus.Infof("serving metrics at %s/metrics", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logrus.Errorf("failed to serve metrics at %s, error: %v", address, err)
+		}
+	}()
+	return nil
+}
+
+// recordJoinOutcome counts the join by its outcome, a failed join is counted by the category of err.
+func recordJoinOutcome(err error) {
+	if err == nil {
+		util2.JoinsTotal.WithLabelValues(string(JoinStepSucceeded), "").Inc()
+		return
+	}
+	util2.JoinsTotal.WithLabelValues(string(JoinStepFailed), string(util2.ClassifyError(err))).Inc()
+}
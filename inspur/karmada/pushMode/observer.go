@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+// JoinStep is a step of joining a member cluster.
+type JoinStep string
+
+const (
+	JoinStepNamespaceEnsured      JoinStep = "NamespaceEnsured"
+	JoinStepServiceAccountEnsured JoinStep = "ServiceAccountEnsured"
+	JoinStepRBACEnsured           JoinStep = "RBACEnsured"
+	JoinStepTokenObtained         JoinStep = "TokenObtained"
+	JoinStepSecretsCreated        JoinStep = "SecretsCreated"
+	JoinStepClusterCreated        JoinStep = "ClusterCreated"
+	JoinStepOwnerRefsPatched      JoinStep = "OwnerRefsPatched"
+)
+
+// JoinStepOutcome is the outcome of a join step. A step is reported as Started before it runs,
+// then as Succeeded or Failed.
+type JoinStepOutcome string
+
+const (
+	JoinStepStarted   JoinStepOutcome = "Started"
+	JoinStepSucceeded JoinStepOutcome = "Succeeded"
+	JoinStepFailed    JoinStepOutcome = "Failed"
+)
+
+const (
+	progressNone    = "none"
+	progressSpinner = "spinner"
+	progressJSON    = "json"
+)
+
+// validateProgress checks the value of --progress.
+func validateProgress(progress string) error {
+	switch progress {
+	case progressNone, progressSpinner, progressJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid progress value %q, should be %s, %s or %s", progress, progressNone, progressSpinner, progressJSON)
+}
+
+// JoinStepEvent is reported to JoinObserver when a join step starts or finishes.
+type JoinStepEvent struct {
+	Cluster   string          `json:"cluster"`
+	Step      JoinStep        `json:"step"`
+	Outcome   JoinStepOutcome `json:"outcome"`
+	Timestamp time.Time       `json:"timestamp"`
+	// Duration is how long the step took, it's zero for a started step.
+	Duration time.Duration `json:"-"`
+	Message  string        `json:"message,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// JoinObserver receives the progress of joining a member cluster.
+type JoinObserver interface {
+	Observe(event JoinStepEvent)
+}
+
+// joinProgress runs the steps of joining a cluster and reports them to the observer.
+type joinProgress struct {
+	cluster  string
+	observer JoinObserver
+}
+
+func newJoinProgress(cluster string, observer JoinObserver) *joinProgress {
+	if observer == nil {
+		observer = noopObserver{}
+	}
+	return &joinProgress{cluster: cluster, observer: observer}
+}
+
+// run reports step as started, runs fn, then reports the outcome with the message returned by fn.
+func (p *joinProgress) run(step JoinStep, fn func() (string, error)) error {
+	start := time.Now()
+	p.observer.Observe(JoinStepEvent{Cluster: p.cluster, Step: step, Outcome: JoinStepStarted, Timestamp: start})
+
+	message, err := fn()
+	event := JoinStepEvent{
+		Cluster:   p.cluster,
+		Step:      step,
+		Outcome:   JoinStepSucceeded,
+		Timestamp: time.Now(),
+		Duration:  time.Since(start),
+		Message:   message,
+	}
+	if err != nil {
+		event.Outcome = JoinStepFailed
+		event.Error = err.Error()
+	}
+	p.observer.Observe(event)
+	return err
+}
+
+// multiObserver reports every event to all the observers.
+type multiObserver []JoinObserver
+
+func (o multiObserver) Observe(event JoinStepEvent) {
+	for _, observer := range o {
+		if observer != nil {
+			observer.Observe(event)
+		}
+	}
+}
+
+// metricsObserver observes the duration of the finished steps.
+type metricsObserver struct{}
+
+func (metricsObserver) Observe(event JoinStepEvent) {
+	if event.Outcome == JoinStepStarted {
+		return
+	}
+	util2.JoinStepDuration.WithLabelValues(string(event.Step), string(event.Outcome)).Observe(event.Duration.Seconds())
+}
+
+type noopObserver struct{}
+
+func (noopObserver) Observe(JoinStepEvent) {}
+
+// jsonLinesObserver writes every event as a line of JSON, so that a portal can follow the join.
+type jsonLinesObserver struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newJSONLinesObserver(w io.Writer) *jsonLinesObserver {
+	return &jsonLinesObserver{encoder: json.NewEncoder(w)}
+}
+
+func (o *jsonLinesObserver) Observe(event JoinStepEvent) {
+	line := struct {
+		JoinStepEvent
+		Duration string `json:"duration,omitempty"`
+	}{JoinStepEvent: event}
+	if event.Outcome != JoinStepStarted {
+		line.Duration = event.Duration.String()
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_ = o.encoder.Encode(line)
+}
+
+// spinnerFrames are the frames of the spinner shown while a step is running.
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// spinnerObserver shows a spinner on the running step, and a check mark or a cross once it finishes.
+type spinnerObserver struct {
+	mu   sync.Mutex
+	out  io.Writer
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSpinnerObserver(out io.Writer) *spinnerObserver {
+	return &spinnerObserver{out: out}
+}
+
+func (o *spinnerObserver) Observe(event JoinStepEvent) {
+	o.stopSpinner()
+	switch event.Outcome {
+	case JoinStepStarted:
+		o.startSpinner(event.Step)
+	case JoinStepSucceeded:
+		fmt.Fprintf(o.out, "\r[✓] %s (%s) %s\n", event.Step, event.Duration.Round(time.Millisecond), event.Message)
+	case JoinStepFailed:
+		fmt.Fprintf(o.out, "\r[✗] %s (%s) %s\n", event.Step, event.Duration.Round(time.Millisecond), event.Error)
+	}
+}
+
+func (o *spinnerObserver) startSpinner(step JoinStep) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stop, o.done = make(chan struct{}), make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(o.out, "\r[%s] %s", spinnerFrames[i%len(spinnerFrames)], step)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(o.stop, o.done)
+}
+
+func (o *spinnerObserver) stopSpinner() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.stop == nil {
+		return
+	}
+	close(o.stop)
+	<-o.done
+	o.stop, o.done = nil, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+	"sigs.k8s.io/yaml"
+)
+
+// planAction tells what join would do to an object.
+type planAction string
+
+const (
+	planActionCreate planAction = "create"
+	planActionExists planAction = "exists"
+	planActionUpdate planAction = "update"
+
+	planClusterMember       = "member"
+	planClusterControlPlane = "control-plane"
+
+	// redactedToken replaces the token of secrets in the plan.
+	redactedToken = "<redacted>"
+)
+
+// planEntry is an object that join would create in a cluster.
+type planEntry struct {
+	Cluster string      `json:"cluster"`
+	Action  planAction  `json:"action"`
+	Object  interface{} `json:"object"`
+}
+
+// joinPlan is the ordered list of the objects that join would create in both clusters.
+type joinPlan struct {
+	ClusterName string      `json:"clusterName"`
+	Entries     []planEntry `json:"entries"`
+}
+
+func (p *joinPlan) add(cluster string, action planAction, obj interface{}) {
+	p.Entries = append(p.Entries, planEntry{Cluster: cluster, Action: action, Object: obj})
+}
+
+// toPlanAction returns the action by whether the object exists and whether its live state differs from the desired one.
+func toPlanAction(err error, equal bool) (planAction, error) {
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return planActionCreate, nil
+		}
+		return "", err
+	}
+	if !equal {
+		return planActionUpdate, nil
+	}
+	return planActionExists, nil
+}
+
+// buildJoinPlan renders the plan of join without changing anything in both clusters.
+func buildJoinPlan(ctx context.Context, clusterKubeClient, controlPlaneKubeClient kubeclient.Interface, karmadaClient *dynamic.DynamicClient, opts util2.ClusterRegisterOption) (*joinPlan, error) {
+	plan := &joinPlan{ClusterName: opts.ClusterName}
+	objects := newMemberClusterObjects(opts)
+
+	// objects in member cluster
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: opts.ClusterNamespace}}
+	namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	_, err := clusterKubeClient.CoreV1().Namespaces().Get(ctx, namespace.Name, metav1.GetOptions{})
+	action, err := toPlanAction(err, true)
+	if err != nil {
+		return nil, err
+	}
+	plan.add(planClusterMember, action, namespace)
+
+	var tokenSecrets []*corev1.Secret
+	for _, sa := range []*corev1.ServiceAccount{objects.serviceAccount, objects.impersonationSA} {
+		sa.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ServiceAccount"))
+		liveSA, err := clusterKubeClient.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
+		action, err := toPlanAction(err, true)
+		if err != nil {
+			return nil, err
+		}
+		plan.add(planClusterMember, action, sa)
+
+		// the token of an existing ServiceAccount is reused by join, found the same way as join waits for it.
+		var tokenSecret *corev1.Secret
+		if action == planActionExists {
+			if tokenSecret, err = util2.NewServiceAccountSecretWaiter(clusterKubeClient, 0).Lookup(ctx, liveSA); err != nil {
+				return nil, err
+			}
+		}
+		tokenSecrets = append(tokenSecrets, tokenSecret)
+	}
+
+	objects.clusterRole.SetGroupVersionKind(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"))
+	liveClusterRole, err := clusterKubeClient.RbacV1().ClusterRoles().Get(ctx, objects.clusterRole.Name, metav1.GetOptions{})
+	action, err = toPlanAction(err, err == nil && equality.Semantic.DeepEqual(liveClusterRole.Rules, objects.clusterRole.Rules))
+	if err != nil {
+		return nil, err
+	}
+	plan.add(planClusterMember, action, objects.clusterRole)
+
+	objects.clusterRoleBinding.SetGroupVersionKind(rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"))
+	liveBinding, err := clusterKubeClient.RbacV1().ClusterRoleBindings().Get(ctx, objects.clusterRoleBinding.Name, metav1.GetOptions{})
+	action, err = toPlanAction(err, err == nil &&
+		equality.Semantic.DeepEqual(liveBinding.Subjects, objects.clusterRoleBinding.Subjects) &&
+		equality.Semantic.DeepEqual(liveBinding.RoleRef, objects.clusterRoleBinding.RoleRef))
+	if err != nil {
+		return nil, err
+	}
+	plan.add(planClusterMember, action, objects.clusterRoleBinding)
+
+	// objects in control plane
+	_, err = controlPlaneKubeClient.CoreV1().Namespaces().Get(ctx, namespace.Name, metav1.GetOptions{})
+	action, err = toPlanAction(err, true)
+	if err != nil {
+		return nil, err
+	}
+	plan.add(planClusterControlPlane, action, namespace.DeepCopy())
+
+	if opts.IsKubeCredentialsEnabled() {
+		if tokenSecrets[0] != nil {
+			opts.Secret = *tokenSecrets[0]
+		}
+		if opts.CABundle, err = mergeClusterCABundle(opts); err != nil {
+			return nil, err
+		}
+		secret := newControlPlaneSecret(opts)
+		if err = planControlPlaneSecret(ctx, plan, controlPlaneKubeClient, secret, tokenSecrets[0] != nil); err != nil {
+			return nil, err
+		}
+		opts.Secret.ObjectMeta = secret.ObjectMeta
+	}
+
+	if opts.IsKubeImpersonatorEnabled() {
+		if tokenSecrets[1] != nil {
+			opts.ImpersonatorSecret = *tokenSecrets[1]
+		}
+		impersonatorSecret := newControlPlaneImpersonatorSecret(opts)
+		if err = planControlPlaneSecret(ctx, plan, controlPlaneKubeClient, impersonatorSecret, tokenSecrets[1] != nil); err != nil {
+			return nil, err
+		}
+		opts.ImpersonatorSecret.ObjectMeta = impersonatorSecret.ObjectMeta
+	}
+
+	clusterObj := newClusterObject(opts)
+	liveCluster, exist, err := util2.GetClusterWithKarmadaClient(ctx, karmadaClient, clusterObj.Name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !exist:
+		action = planActionCreate
+	case clusterUpToDate(liveCluster, clusterObj):
+		action = planActionExists
+	default:
+		action = planActionUpdate
+	}
+	plan.add(planClusterControlPlane, action, clusterObj)
+
+	return plan, nil
+}
+
+// clusterUpToDate tells if the live Cluster already has the labels, annotations and spec that join applies.
+// The labels, annotations and taints set by others are kept by the apply, so they are not compared, nor are
+// the provider, region and zone when join leaves them unset.
+func clusterUpToDate(live, desired *clusterv1alpha1.Cluster) bool {
+	for key, value := range desired.Labels {
+		if liveValue, ok := live.Labels[key]; !ok || liveValue != value {
+			return false
+		}
+	}
+	for key, value := range desired.Annotations {
+		if liveValue, ok := live.Annotations[key]; !ok || liveValue != value {
+			return false
+		}
+	}
+
+	spec := desired.Spec
+	spec.Taints = live.Spec.Taints
+	if spec.Provider == "" {
+		spec.Provider = live.Spec.Provider
+	}
+	if spec.Region == "" {
+		spec.Region = live.Spec.Region
+	}
+	if spec.Zone == "" {
+		spec.Zone = live.Spec.Zone
+	}
+	return equality.Semantic.DeepEqual(spec, live.Spec)
+}
+
+// planControlPlaneSecret adds the secret to plan with its token redacted. If the token is not issued yet,
+// the secret is only compared by the keys.
+func planControlPlaneSecret(ctx context.Context, plan *joinPlan, client kubeclient.Interface, secret *corev1.Secret, tokenIssued bool) error {
+	liveSecret, err := client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	equal := err == nil
+	if err == nil {
+		for key, value := range secret.Data {
+			liveValue, ok := liveSecret.Data[key]
+			if !ok || (tokenIssued && string(liveValue) != string(value)) {
+				equal = false
+			}
+		}
+	}
+	action, err := toPlanAction(err, equal)
+	if err != nil {
+		return err
+	}
+
+	planSecret := &corev1.Secret{ObjectMeta: secret.ObjectMeta, StringData: map[string]string{}}
+	planSecret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	for key, value := range secret.Data {
+		planSecret.StringData[key] = string(value)
+	}
+	planSecret.StringData[SecretTokenKey] = redactedToken
+	plan.add(planClusterControlPlane, action, planSecret)
+	return nil
+}
+
+// printOutput writes the object to w as YAML or JSON.
+func printOutput(w io.Writer, obj interface{}, output string) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch output {
+	case "yaml":
+		data, err = yaml.Marshal(obj)
+	case "json":
+		data, err = json.MarshalIndent(obj, "", "  ")
+	default:
+		return fmt.Errorf("unsupported output format %q, should be yaml or json", output)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
 	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -27,7 +35,13 @@ const (
 	// KarmadaConfigPath is the path to karmada-apiserver.config
 	KarmadaConfigPath = "/etc/karmada/karmada-apiserver.config"
 
+	defaultKarmadaConfigPath = "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\karmada-apiserver.config"
+	defaultKubeconfigPath    = "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\config"
+
 	GroupName = "cluster.karmada.io"
+
+	// proxyCheckTimeout is the timeout of the connectivity test through proxy at join and of the credentials check at rotation.
+	proxyCheckTimeout = 10 * time.Second
 )
 
 var (
@@ -51,26 +65,232 @@ var (
 )
 
 func main() {
-	clusterName := "test1"
-	karmadaConfigPath := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\karmada-apiserver.config"
-	kubeconfigPath := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\config"
+	// Ctrl-C cancels the requests in flight, so that the command aborts instead of hanging.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	command, args := "join", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", karmadaConfigPath)
+	var err error
+	switch command {
+	case "join":
+		err = runJoin(ctx, args)
+	case "rotate-credentials":
+		err = runRotateCredentials(ctx, args)
+	case "doctor":
+		err = runDoctor(ctx, args)
+	case "taint":
+		err = runTaint(ctx, args)
+	case "cordon":
+		err = runMaintenanceTaint(ctx, command, corev1.TaintEffectNoSchedule, args)
+	case "drain":
+		err = runMaintenanceTaint(ctx, command, corev1.TaintEffectNoExecute, args)
+	case "uncordon":
+		err = runUncordon(ctx, args)
+	case "expire-taints":
+		err = runExpireTaints(ctx, args)
+	case "verify":
+		err = runVerify(args)
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
 	if err != nil {
-		panic(err.Error())
+		logrus.Errorf("%s  ====>   err: %s", command, err.Error())
+		cancel()
+		os.Exit(1)
 	}
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+}
+
+// newCommandFlagSet returns the flag set of a command with the kubeconfig flags for both clusters.
+func newCommandFlagSet(command string) (*flag.FlagSet, *string, *string) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	karmadaConfigPath := flags.String("karmada-config", defaultKarmadaConfigPath, "path to the kubeconfig of karmada control plane")
+	kubeconfigPath := flags.String("kubeconfig", defaultKubeconfigPath, "path to the kubeconfig of member cluster")
+	flags.StringVar(&auditLogPath, "audit-log", util2.DefaultAuditLogPath, "path to the append-only audit log of state changing operations")
+	flags.StringVar(&metricsBindAddress, "metrics-bind-address", "", "address to serve /metrics on while the command runs, e.g. :8080, disabled if not set")
+	return flags, karmadaConfigPath, kubeconfigPath
+}
+
+// parseCommandFlags parses the flags of a command and starts serving metrics if --metrics-bind-address is set.
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	_ = flags.Parse(args)
+	if metricsBindAddress == "" {
+		return nil
+	}
+	return serveMetrics(metricsBindAddress)
+}
+
+func runJoin(ctx context.Context, args []string) error {
+	flags, karmadaConfigPath, kubeconfigPath := newCommandFlagSet("join")
+	clusterName := flags.String("cluster-name", "test1", "name of the member cluster")
+	labels, annotations := keyValueFlag{}, keyValueFlag{}
+	flags.Var(labels, "labels", "labels of the Cluster object, in the form of key1=value1,key2=value2")
+	flags.Var(annotations, "annotations", "annotations of the Cluster object, in the form of key1=value1,key2=value2")
+	clusterAPIEndpoint := flags.String("cluster-api-endpoint", "", "API endpoint of the member cluster reached by control plane, defaults to the server in --kubeconfig")
+	proxyServerAddress := flags.String("proxy-server-address", "", "url of the proxy that control plane reaches the member cluster through, the scheme can be http, https or socks5")
+	proxyHeader := keyValueFlag{}
+	flags.Var(proxyHeader, "proxy-header", "headers sent to the http or https proxy, in the form of key1=value1,key2=value2")
+	reportSecrets := flags.String("report-secrets", util2.KubeCredentials+","+util2.KubeImpersonator,
+		fmt.Sprintf("secrets reported to control plane, any of %s and %s, or %s", util2.KubeCredentials, util2.KubeImpersonator, util2.None))
+	dryRun := flags.String("dry-run", dryRunNone, "none, client to print the objects that would be created in both clusters, "+
+		"or server to send every apply to both clusters in server side dry-run mode")
+	output := flags.String("output", "yaml", "output format of --dry-run, yaml or json")
+	insecureSkipTLSVerification := flags.Bool("insecure-skip-tls-verification", false, "allow control plane to skip verifying the serving certificate of member cluster")
+	labelsFromNodeTopology := flags.Bool("labels-from-node-topology", false, "derive region and zone labels of the Cluster object from member cluster nodes")
+	serviceAccountSecretTimeout := flags.Duration("service-account-secret-timeout", util2.DefaultServiceAccountSecretTimeout,
+		"time to wait for the token secrets of the ServiceAccounts created in member cluster")
+	forceConflicts := flags.Bool("force-conflicts", false, "take over the fields of the joined objects that are managed by others")
+	reportChanges := flags.Bool("report-changes", false, "read every object before applying it to report whether join created, updated "+
+		"or left it unchanged, at the cost of a GET per object")
+	joinLeaseDuration := flags.Duration("join-lease-duration", util2.DefaultJoinLeaseDuration,
+		"how long the lease locking the member cluster during join is valid without being renewed, a stale lease is taken over")
+	progress := flags.String("progress", progressSpinner, "how the progress of join is shown, spinner, json for a line of JSON per step event, or none")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if err := validateDryRun(*dryRun); err != nil {
+		return err
+	}
+	if err := validateProgress(*progress); err != nil {
+		return err
+	}
+
+	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", *karmadaConfigPath)
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	registerOption := util2.ClusterRegisterOption{
+		ClusterNamespace:       "karmada-cluster",
+		ClusterName:            *clusterName,
+		ReportSecrets:          strings.Split(*reportSecrets, ","),
+		ClusterAPIEndpoint:     *clusterAPIEndpoint,
+		ProxyServerAddress:     *proxyServerAddress,
+		ProxyHeader:            proxyHeader,
+		ClusterProvider:        "",
+		ClusterRegion:          "",
+		ClusterZone:            "",
+		Labels:                 labels,
+		Annotations:            annotations,
+		LabelsFromNodeTopology: *labelsFromNodeTopology,
+		ForceConflicts:         *forceConflicts,
+		ReportChanges:          *reportChanges,
+
+		ServiceAccountSecretTimeout: *serviceAccountSecretTimeout,
+		JoinLeaseDuration:           *joinLeaseDuration,
+
+		InsecureSkipTLSVerification: *insecureSkipTLSVerification,
 	}
 	//namespace?
-	err = joinCluster(karmadaConfig, config, clusterName)
+	switch *dryRun {
+	case dryRunClient:
+		plan, err := planJoin(ctx, karmadaConfig, config, registerOption)
+		if err != nil {
+			return err
+		}
+		return printOutput(os.Stdout, plan, *output)
+	case dryRunServer:
+		report, err := serverDryRunJoin(ctx, karmadaConfig, config, registerOption)
+		if err != nil {
+			return err
+		}
+		if err = printOutput(os.Stdout, report, *output); err != nil {
+			return err
+		}
+		if !report.Passed() {
+			return fmt.Errorf("server side dry-run of cluster(%s) failed", registerOption.ClusterName)
+		}
+		return nil
+	}
+	var observer JoinObserver
+	switch *progress {
+	case progressSpinner:
+		observer = newSpinnerObserver(os.Stderr)
+	case progressJSON:
+		// the events are the only output, so that every line of stdout can be parsed.
+		observer = newJSONLinesObserver(os.Stdout)
+	}
+	err = joinCluster(ctx, karmadaConfig, config, registerOption, multiObserver{observer, metricsObserver{}})
+	recordJoinOutcome(err)
+	err = recordAudit(&util2.AuditRecord{
+		Operation: "join",
+		Cluster:   registerOption.ClusterName,
+		Objects:   joinAuditObjects(registerOption),
+	}, err)
 	if err != nil {
-		logrus.Errorf("JoinCluster  ====>   err: %s", err.Error())
+		return err
+	}
+	if *progress != progressJSON {
+		fmt.Printf("cluster(%s) is joined successfully\n", registerOption.ClusterName)
 	}
+	return nil
 }
 
-func joinCluster(controlPlaneRestConfig, clusterConfig *rest.Config, clusterName string) error {
+func runRotateCredentials(ctx context.Context, args []string) error {
+	flags, karmadaConfigPath, _ := newCommandFlagSet("rotate-credentials")
+	clusterName := flags.String("cluster-name", "", "name of the cluster to rotate, required unless --schedule is set")
+	clusterNamespace := flags.String("cluster-namespace", "karmada-cluster", "namespace of the ServiceAccounts in member cluster")
+	schedule := flags.Bool("schedule", false, "rotate all push mode clusters whose credentials are older than --older-than-days periodically")
+	olderThanDays := flags.Int("older-than-days", 30, "rotate the credentials older than this many days in scheduled mode")
+	interval := flags.Duration("interval", time.Hour, "interval between two rounds of scheduled rotation")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", *karmadaConfigPath)
+	if err != nil {
+		return err
+	}
+
+	if *schedule {
+		runScheduledRotation(ctx, karmadaConfig, *clusterNamespace, time.Duration(*olderThanDays)*24*time.Hour, *interval)
+		return nil
+	}
+	if *clusterName == "" {
+		return fmt.Errorf("--cluster-name is required")
+	}
+	return rotateClusterCredentials(ctx, karmadaConfig, *clusterName, *clusterNamespace)
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	flags, karmadaConfigPath, _ := newCommandFlagSet("doctor")
+	output := flags.String("output", "table", "output format, table or json")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of each request to member cluster")
+	recordEvents := flags.Bool("record-events", false, "record an event against the Cluster object when its health changes")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", *karmadaConfigPath)
+	if err != nil {
+		return err
+	}
+
+	diagnoses, err := diagnoseClusters(ctx, karmadaConfig, *timeout, *recordEvents)
+	if err != nil {
+		return err
+	}
+	if err = printDiagnoses(os.Stdout, diagnoses, *output); err != nil {
+		return err
+	}
+	for _, diagnosis := range diagnoses {
+		if !diagnosis.Healthy() {
+			return fmt.Errorf("cluster(%s) is unhealthy", diagnosis.Cluster)
+		}
+	}
+	return nil
+}
+
+// joinCluster registers the member cluster in control plane, the progress of every step is reported to observer.
+func joinCluster(ctx context.Context, controlPlaneRestConfig, clusterConfig *rest.Config, registerOption util2.ClusterRegisterOption,
+	observer JoinObserver) error {
 	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(controlPlaneRestConfig)
 	karmadaClient, err := dynamic.NewForConfig(controlPlaneRestConfig)
 	if err != nil {
@@ -80,140 +300,451 @@ func joinCluster(controlPlaneRestConfig, clusterConfig *rest.Config, clusterName
 
 	clusterKubeClient := kubeclient.NewForConfigOrDie(clusterConfig)
 
-	registerOption := util2.ClusterRegisterOption{
-		ClusterNamespace:   "karmada-cluster",
-		ClusterName:        clusterName,
-		ReportSecrets:      []string{util2.KubeCredentials, util2.KubeImpersonator},
-		ClusterProvider:    "",
-		ClusterRegion:      "",
-		ClusterZone:        "",
-		DryRun:             false,
-		ControlPlaneConfig: controlPlaneRestConfig,
-		ClusterConfig:      clusterConfig,
-	}
+	registerOption.ControlPlaneConfig = controlPlaneRestConfig
+	registerOption.ClusterConfig = clusterConfig
 
-	// 得到 kube-system 的UID
-	id, err := util2.ObtainClusterID(clusterKubeClient)
+	// the lease keyed by the cluster ID keeps two processes from joining the same member cluster at once.
+	id, err := validateJoin(ctx, clusterKubeClient, registerOption)
 	if err != nil {
 		return err
 	}
+	lease := util2.NewClusterLease(controlPlaneKubeClient, id, util2.JoinLeaseHolderIdentity(), registerOption.JoinLeaseDuration)
+	return lease.Hold(ctx, func(ctx context.Context) error {
+		return joinClusterWithLease(ctx, controlPlaneKubeClient, clusterKubeClient, karmadaClient, id, registerOption, observer)
+	})
+}
 
-	// 判断集群是否已经加入
-	ok, name, err := util2.IsClusterIdentifyUnique(karmadaClient, id) //karmadaClient
+// joinClusterWithLease runs the steps of join while the lease of the member cluster is held.
+func joinClusterWithLease(ctx context.Context, controlPlaneKubeClient, clusterKubeClient kubeclient.Interface, karmadaClient *dynamic.DynamicClient,
+	id string, registerOption util2.ClusterRegisterOption, observer JoinObserver) error {
+	err := prepareJoin(ctx, clusterKubeClient, karmadaClient, id, &registerOption)
 	if err != nil {
 		return err
 	}
-	if !ok {
-		return fmt.Errorf("the same cluster has been registered with name %s", name)
-	}
-	//
-	registerOption.ClusterID = id
 
+	clusterConfig := registerOption.ClusterConfig
 	logrus.Infof("joining cluster config. endpoint: %s", clusterConfig.Host)
+	progress := newJoinProgress(registerOption.ClusterName, observer)
 	clusterSecret, impersonatorSecret, err := obtainCredentialsFromMemberCluster(
-		clusterKubeClient, registerOption)
+		ctx, clusterKubeClient, registerOption, progress)
 	if err != nil {
 		return err
 	}
 
-	registerOption.Secret = *clusterSecret
-	registerOption.ImpersonatorSecret = *impersonatorSecret
+	if clusterSecret != nil {
+		registerOption.Secret = *clusterSecret
+	}
+	if impersonatorSecret != nil {
+		registerOption.ImpersonatorSecret = *impersonatorSecret
+	}
+	// 合并CA并校验成员集群的服务证书, whichever secrets are reported.
+	if registerOption.CABundle, err = buildClusterCABundle(ctx, registerOption); err != nil {
+		return err
+	}
 	// 注册集群到ControllerPlane
-	err = registerClusterInControllerPlane(registerOption, controlPlaneKubeClient)
+	return registerClusterInControllerPlane(ctx, registerOption, controlPlaneKubeClient, progress)
+}
+
+// planJoin renders the objects that join would create in both clusters, without changing anything.
+func planJoin(ctx context.Context, controlPlaneRestConfig, clusterConfig *rest.Config, registerOption util2.ClusterRegisterOption) (*joinPlan, error) {
+	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(controlPlaneRestConfig)
+	karmadaClient, err := dynamic.NewForConfig(controlPlaneRestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterKubeClient := kubeclient.NewForConfigOrDie(clusterConfig)
+
+	registerOption.ControlPlaneConfig = controlPlaneRestConfig
+	registerOption.ClusterConfig = clusterConfig
+	id, err := validateJoin(ctx, clusterKubeClient, registerOption)
+	if err != nil {
+		return nil, err
+	}
+	if err = prepareJoin(ctx, clusterKubeClient, karmadaClient, id, &registerOption); err != nil {
+		return nil, err
+	}
+	return buildJoinPlan(ctx, clusterKubeClient, controlPlaneKubeClient, karmadaClient, registerOption)
+}
+
+// validateJoin validates the option and returns the cluster ID of the member cluster.
+// Nothing is changed in both clusters.
+func validateJoin(ctx context.Context, clusterKubeClient kubeclient.Interface, registerOption util2.ClusterRegisterOption) (string, error) {
+	if err := registerOption.Validate(); err != nil {
+		return "", err
+	}
+	if registerOption.ClusterConfig.TLSClientConfig.Insecure && !registerOption.InsecureSkipTLSVerification {
+		return "", fmt.Errorf("the kubeconfig of member cluster skips TLS verification, which is refused unless --insecure-skip-tls-verification is set")
+	}
+
+	// 得到 kube-system 的UID
+	return util2.ObtainClusterID(ctx, clusterKubeClient)
+}
+
+// prepareJoin fills the cluster ID returned by validateJoin, the derived labels and the proxy in the option.
+// Nothing is changed in both clusters.
+func prepareJoin(ctx context.Context, clusterKubeClient kubeclient.Interface, karmadaClient *dynamic.DynamicClient, id string,
+	registerOption *util2.ClusterRegisterOption) error {
+	// 判断集群是否已经加入
+	// the clusters are read live from control plane, so that a registration written by the previous lease holder is seen.
+	ok, name, err := util2.IsClusterIdentifyUnique(ctx, karmadaClient, id) //karmadaClient
 	if err != nil {
 		return err
 	}
+	// joining again with the same name repairs the registration.
+	if !ok && name != registerOption.ClusterName {
+		return fmt.Errorf("the same cluster has been registered with name %s", name)
+	}
+	// applying the Cluster object would take over the name registered by another cluster.
+	if ok {
+		existing, exist, err := util2.GetClusterWithKarmadaClient(ctx, karmadaClient, registerOption.ClusterName)
+		if err != nil {
+			return err
+		}
+		if exist && existing.Spec.ID != id {
+			return fmt.Errorf("cluster name %s has been registered by another cluster", registerOption.ClusterName)
+		}
+	}
+	//
+	registerOption.ClusterID = id
+
+	if registerOption.LabelsFromNodeTopology {
+		topologyLabels, err := util2.ObtainClusterTopologyLabels(ctx, clusterKubeClient)
+		if err != nil {
+			return fmt.Errorf("failed to derive labels from node topology, error: %w", err)
+		}
+		labels := topologyLabels
+		for key, value := range registerOption.Labels {
+			labels[key] = value
+		}
+		registerOption.Labels = labels
+	}
+
+	// 解析代理并测试连通性
+	return resolveJoinProxy(ctx, registerOption)
+}
+
+// resolveJoinProxy decides the proxy that control plane reaches the member cluster through, and makes sure
+// the member cluster can be reached through it before the Cluster object is created.
+func resolveJoinProxy(ctx context.Context, opts *util2.ClusterRegisterOption) error {
+	endpoint := opts.ClusterConfig.Host
+	if opts.ClusterAPIEndpoint != "" {
+		endpoint = opts.ClusterAPIEndpoint
+	}
+
+	// the proxy in kubeconfig is used if no proxy is specified explicitly.
+	if opts.ProxyServerAddress == "" {
+		proxy, err := util2.ResolveProxy(opts.ClusterConfig, endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to resolve proxy of cluster(%s), error: %w", opts.ClusterName, err)
+		}
+		if proxy == nil {
+			if len(opts.ProxyHeader) > 0 {
+				return fmt.Errorf("proxy header is specified without a proxy")
+			}
+			return nil
+		}
+		opts.ProxyServerAddress = proxy.String()
+	}
 
-	fmt.Printf("cluster(%s) is joined successfully\n", clusterName)
+	proxy, err := util2.ParseProxyURL(opts.ProxyServerAddress)
+	if err != nil {
+		return err
+	}
+	// a socks5 proxy takes no CONNECT request, so there is nowhere to send the headers.
+	if proxy.Scheme == "socks5" && len(opts.ProxyHeader) > 0 {
+		return fmt.Errorf("proxy header is not supported by socks5 proxy %s", proxy.Redacted())
+	}
+	checkConfig := rest.CopyConfig(opts.ClusterConfig)
+	checkConfig.Host = endpoint
+	util2.SetProxy(checkConfig, proxy, opts.ProxyHeader)
+	if err = util2.CheckClusterConnectivity(ctx, checkConfig, proxyCheckTimeout); err != nil {
+		return fmt.Errorf("failed to reach cluster(%s) at %s through proxy %s, error: %w", opts.ClusterName, endpoint, proxy.Redacted(), err)
+	}
+	logrus.Infof("cluster(%s) is reachable through proxy %s", opts.ClusterName, proxy.Redacted())
 	return nil
 }
 
-// 从成员集群获取凭证
-func obtainCredentialsFromMemberCluster(clusterKubeClient kubeclient.Interface, opts util2.ClusterRegisterOption) (*corev1.Secret, *corev1.Secret, error) {
-	var err error
+// mergeClusterCABundle merges the CA of member cluster kubeconfig with the one in ServiceAccount secret. The
+// ServiceAccount secret is empty if the credentials are not reported, and the bundle is nil if there is no CA
+// at all, so that the system roots are trusted.
+func mergeClusterCABundle(opts util2.ClusterRegisterOption) ([]byte, error) {
+	configCAData, err := util2.LoadConfigCAData(opts.ClusterConfig)
+	if err != nil {
+		return nil, err
+	}
+	secretCAData := opts.Secret.Data[corev1.ServiceAccountRootCAKey]
+	if len(configCAData) == 0 && len(secretCAData) == 0 {
+		return nil, nil
+	}
+	caBundle, err := util2.MergeCABundle(configCAData, secretCAData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build CA bundle of cluster(%s), error: %w", opts.ClusterName, err)
+	}
+	return caBundle, nil
+}
 
-	// ensure namespace where the karmada control plane credential be stored exists in cluster.
-	if _, err = util2.EnsureNamespaceExist(clusterKubeClient, opts.ClusterNamespace, opts.DryRun); err != nil {
-		return nil, nil, err
+// buildClusterCABundle merges the CA bundle of member cluster, and verifies the serving certificate of member
+// cluster against it.
+func buildClusterCABundle(ctx context.Context, opts util2.ClusterRegisterOption) ([]byte, error) {
+	caBundle, err := mergeClusterCABundle(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.InsecureSkipTLSVerification {
+		logrus.Warnf("skip verifying the serving certificate of cluster(%s) as requested", opts.ClusterName)
+		return caBundle, nil
 	}
 
-	// create a ServiceAccount in cluster.
+	endpoint := opts.ClusterConfig.Host
+	if opts.ClusterAPIEndpoint != "" {
+		endpoint = opts.ClusterAPIEndpoint
+	}
+	var proxy *url.URL
+	if opts.ProxyServerAddress != "" {
+		if proxy, err = util2.ParseProxyURL(opts.ProxyServerAddress); err != nil {
+			return nil, err
+		}
+	}
+	if err = util2.VerifyServingCertificate(ctx, endpoint, caBundle, proxy, opts.ProxyHeader, proxyCheckTimeout); err != nil {
+		return nil, fmt.Errorf("failed to verify the serving certificate of cluster(%s) at %s against the CA bundle, error: %w", opts.ClusterName, endpoint, err)
+	}
+	return caBundle, nil
+}
+
+// memberClusterObjects are the objects created in member cluster for control plane to access it.
+type memberClusterObjects struct {
+	serviceAccount     *corev1.ServiceAccount
+	impersonationSA    *corev1.ServiceAccount
+	clusterRole        *rbacv1.ClusterRole
+	clusterRoleBinding *rbacv1.ClusterRoleBinding
+}
+
+func newMemberClusterObjects(opts util2.ClusterRegisterOption) *memberClusterObjects {
+	// a ServiceAccount in cluster.
 	serviceAccountObj := &corev1.ServiceAccount{}
 	serviceAccountObj.Namespace = opts.ClusterNamespace
 	serviceAccountObj.Name = names2.GenerateServiceAccountName(opts.ClusterName)
-	if serviceAccountObj, err = util2.EnsureServiceAccountExist(clusterKubeClient, serviceAccountObj, opts.DryRun); err != nil {
-		return nil, nil, err
-	}
 
-	// create a ServiceAccount for impersonation in cluster.
+	// a ServiceAccount for impersonation in cluster.
 	impersonationSA := &corev1.ServiceAccount{}
 	impersonationSA.Namespace = opts.ClusterNamespace
 	impersonationSA.Name = names2.GenerateServiceAccountName("impersonator")
-	if impersonationSA, err = util2.EnsureServiceAccountExist(clusterKubeClient, impersonationSA, opts.DryRun); err != nil {
-		return nil, nil, err
-	}
 
-	// create a ClusterRole in cluster.
+	// a ClusterRole in cluster.
 	clusterRole := &rbacv1.ClusterRole{}
 	clusterRole.Name = names2.GenerateRoleName(serviceAccountObj.Name)
 	clusterRole.Rules = clusterPolicyRules
-	if _, err = ensureClusterRoleExist(clusterKubeClient, clusterRole, opts.DryRun); err != nil {
-		return nil, nil, err
-	}
 
-	// create a ClusterRoleBinding in cluster.
+	// a ClusterRoleBinding in cluster.
 	clusterRoleBinding := &rbacv1.ClusterRoleBinding{}
 	clusterRoleBinding.Name = clusterRole.Name
 	clusterRoleBinding.Subjects = buildRoleBindingSubjects(serviceAccountObj.Name, serviceAccountObj.Namespace)
 	clusterRoleBinding.RoleRef = buildClusterRoleReference(clusterRole.Name)
-	if _, err = ensureClusterRoleBindingExist(clusterKubeClient, clusterRoleBinding, opts.DryRun); err != nil {
+
+	return &memberClusterObjects{
+		serviceAccount:     serviceAccountObj,
+		impersonationSA:    impersonationSA,
+		clusterRole:        clusterRole,
+		clusterRoleBinding: clusterRoleBinding,
+	}
+}
+
+// 从成员集群获取凭证
+func obtainCredentialsFromMemberCluster(ctx context.Context, clusterKubeClient kubeclient.Interface, opts util2.ClusterRegisterOption,
+	progress *joinProgress) (*corev1.Secret, *corev1.Secret, error) {
+	objects := newMemberClusterObjects(opts)
+
+	// apply namespace where the karmada control plane credential be stored in cluster.
+	err := progress.run(JoinStepNamespaceEnsured, func() (string, error) {
+		_, result, err := util2.ApplyNamespace(ctx, clusterKubeClient, opts.ClusterNamespace, opts.ApplyOptions())
+		if err != nil {
+			return "", util2.ApplyConflictError(fmt.Sprintf("Namespace %s in cluster(%s)", opts.ClusterNamespace, opts.ClusterName), err)
+		}
+		return fmt.Sprintf("Namespace %s in cluster(%s) %s", opts.ClusterNamespace, opts.ClusterName, result), nil
+	})
+	if err != nil {
 		return nil, nil, err
 	}
 
-	if opts.DryRun {
-		return nil, nil, nil
+	// apply a ServiceAccount and a ServiceAccount for impersonation in cluster.
+	var serviceAccountObj, impersonationSA *corev1.ServiceAccount
+	err = progress.run(JoinStepServiceAccountEnsured, func() (string, error) {
+		var serviceAccountResult, impersonationSAResult util2.OperationResult
+		serviceAccountObj, serviceAccountResult, err = util2.ApplyServiceAccount(ctx, clusterKubeClient, objects.serviceAccount, opts.ApplyOptions())
+		if err != nil {
+			return "", util2.ApplyConflictError(fmt.Sprintf("ServiceAccount %s/%s in cluster(%s)",
+				objects.serviceAccount.Namespace, objects.serviceAccount.Name, opts.ClusterName), err)
+		}
+		impersonationSA, impersonationSAResult, err = util2.ApplyServiceAccount(ctx, clusterKubeClient, objects.impersonationSA, opts.ApplyOptions())
+		if err != nil {
+			return "", util2.ApplyConflictError(fmt.Sprintf("ServiceAccount %s/%s in cluster(%s)",
+				objects.impersonationSA.Namespace, objects.impersonationSA.Name, opts.ClusterName), err)
+		}
+		return fmt.Sprintf("ServiceAccount %s %s, ServiceAccount %s %s in namespace %s",
+			serviceAccountObj.Name, serviceAccountResult, impersonationSA.Name, impersonationSAResult, opts.ClusterNamespace), nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	// 使用k8s封装的重试机制进行尝试获取
-	clusterSecret, err := util2.WaitForServiceAccountSecretCreation(clusterKubeClient, serviceAccountObj)
+
+	// apply a ClusterRole and a ClusterRoleBinding in cluster.
+	err = progress.run(JoinStepRBACEnsured, func() (string, error) {
+		_, clusterRoleResult, err := util2.ApplyClusterRole(ctx, clusterKubeClient, objects.clusterRole, opts.ApplyOptions())
+		if err != nil {
+			return "", util2.ApplyConflictError(fmt.Sprintf("ClusterRole %s in cluster(%s)", objects.clusterRole.Name, opts.ClusterName), err)
+		}
+		_, clusterRoleBindingResult, err := util2.ApplyClusterRoleBinding(ctx, clusterKubeClient, objects.clusterRoleBinding, opts.ApplyOptions())
+		if err != nil {
+			return "", util2.ApplyConflictError(fmt.Sprintf("ClusterRoleBinding %s in cluster(%s)", objects.clusterRoleBinding.Name, opts.ClusterName), err)
+		}
+		return fmt.Sprintf("ClusterRole %s %s, ClusterRoleBinding %s %s",
+			objects.clusterRole.Name, clusterRoleResult, objects.clusterRoleBinding.Name, clusterRoleBindingResult), nil
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get serviceAccount secret from cluster(%s), error: %v", opts.ClusterName, err)
+		return nil, nil, err
 	}
 
-	impersonatorSecret, err := util2.WaitForServiceAccountSecretCreation(clusterKubeClient, impersonationSA)
+	// 只获取需要上报的secret
+	var clusterSecret, impersonatorSecret *corev1.Secret
+	err = progress.run(JoinStepTokenObtained, func() (string, error) {
+		var obtained []string
+		if opts.IsKubeCredentialsEnabled() {
+			clusterSecret, err = util2.WaitForServiceAccountSecretCreation(ctx, clusterKubeClient, serviceAccountObj, opts.ServiceAccountSecretTimeout)
+			if err != nil {
+				return "", fmt.Errorf("failed to get serviceAccount secret from cluster(%s), error: %w", opts.ClusterName, err)
+			}
+			obtained = append(obtained, clusterSecret.Name)
+		}
+		if opts.IsKubeImpersonatorEnabled() {
+			impersonatorSecret, err = util2.WaitForServiceAccountSecretCreation(ctx, clusterKubeClient, impersonationSA, opts.ServiceAccountSecretTimeout)
+			if err != nil {
+				return "", fmt.Errorf("failed to get serviceAccount secret for impersonation from cluster(%s), error: %w", opts.ClusterName, err)
+			}
+			obtained = append(obtained, impersonatorSecret.Name)
+		}
+		return fmt.Sprintf("token secrets %v obtained", obtained), nil
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get serviceAccount secret for impersonation from cluster(%s), error: %v", opts.ClusterName, err)
+		return nil, nil, err
 	}
 
 	return clusterSecret, impersonatorSecret, nil
 }
 
-func registerClusterInControllerPlane(opts util2.ClusterRegisterOption, controlPlaneKubeClient kubeclient.Interface) error {
-	// ensure namespace where the cluster object be stored exists in control plane.
-	// 查看namespace
-	if _, err := util2.EnsureNamespaceExist(controlPlaneKubeClient, opts.ClusterNamespace, opts.DryRun); err != nil {
+func registerClusterInControllerPlane(ctx context.Context, opts util2.ClusterRegisterOption, controlPlaneKubeClient kubeclient.Interface,
+	progress *joinProgress) error {
+	controlPlaneKarmadaClient, err := dynamic.NewForConfig(opts.ControlPlaneConfig)
+	if err != nil {
+		return err
+	}
+	// the secrets of an existing Cluster are applied with their owner references at once, so that a re-join
+	// does not drop the references owned by join and add them back.
+	existingCluster, exist, err := util2.GetClusterWithKarmadaClient(ctx, controlPlaneKarmadaClient, opts.ClusterName)
+	if err != nil {
+		return err
+	}
+	withOwnerRefs := func(secret *corev1.Secret) *corev1.Secret {
+		if exist {
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(existingCluster, clusterResourceKind)}
+		}
+		return secret
+	}
+
+	var secrets []*corev1.Secret
+	err = progress.run(JoinStepSecretsCreated, func() (string, error) {
+		// apply namespace where the cluster object be stored in control plane.
+		_, result, err := util2.ApplyNamespace(ctx, controlPlaneKubeClient, opts.ClusterNamespace, opts.ApplyOptions())
+		if err != nil {
+			return "", util2.ApplyConflictError(fmt.Sprintf("Namespace %s in control plane", opts.ClusterNamespace), err)
+		}
+
+		applied := []string{fmt.Sprintf("Namespace %s %s", opts.ClusterNamespace, result)}
+		if opts.IsKubeCredentialsEnabled() {
+			// 1、在host集群中apply对应的secret
+			secret, result, err := util2.ApplySecret(ctx, controlPlaneKubeClient, withOwnerRefs(newControlPlaneSecret(opts)), opts.ApplyOptions())
+			if err != nil {
+				return "", util2.ApplyConflictError(fmt.Sprintf("secret %s/%s in control plane", opts.ClusterNamespace, opts.ClusterName), err)
+			}
+			opts.Secret = *secret
+			secrets = append(secrets, newControlPlaneSecret(opts))
+			applied = append(applied, fmt.Sprintf("Secret %s %s", secret.Name, result))
+		}
+
+		if opts.IsKubeImpersonatorEnabled() {
+			//2、在host集群中apply impersonatorSecret
+			impersonatorSecret, result, err := util2.ApplySecret(ctx, controlPlaneKubeClient, withOwnerRefs(newControlPlaneImpersonatorSecret(opts)), opts.ApplyOptions())
+			if err != nil {
+				return "", util2.ApplyConflictError(fmt.Sprintf("impersonator secret of cluster(%s) in control plane", opts.ClusterName), err)
+			}
+			opts.ImpersonatorSecret = *impersonatorSecret
+			secrets = append(secrets, newControlPlaneImpersonatorSecret(opts))
+			applied = append(applied, fmt.Sprintf("Secret %s %s", impersonatorSecret.Name, result))
+		}
+		return fmt.Sprintf("%s in control plane", strings.Join(applied, ", ")), nil
+	})
+	if err != nil {
 		return err
 	}
 
-	// create secret in control plane
-	secret := &corev1.Secret{
+	// 创建集群
+	var cluster *clusterv1alpha1.Cluster
+	err = progress.run(JoinStepClusterCreated, func() (string, error) {
+		var result util2.OperationResult
+		cluster, result, err = generateClusterInControllerPlane(ctx, controlPlaneKarmadaClient, opts)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Cluster %s in control plane %s", cluster.Name, result), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the owner references are applied together with the data, so that join keeps owning both of them.
+	err = progress.run(JoinStepOwnerRefsPatched, func() (string, error) {
+		if exist && existingCluster.UID == cluster.UID {
+			return fmt.Sprintf("Secrets are applied owned by the existing Cluster %s", cluster.Name), nil
+		}
+		var patched []string
+		for _, secret := range secrets {
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(cluster, clusterResourceKind)}
+			_, result, err := util2.ApplySecret(ctx, controlPlaneKubeClient, secret, opts.ApplyOptions())
+			if err != nil {
+				return "", util2.ApplyConflictError(fmt.Sprintf("owner references of secret %s/%s", secret.Namespace, secret.Name), err)
+			}
+			patched = append(patched, fmt.Sprintf("Secret %s %s", secret.Name, result))
+		}
+		return fmt.Sprintf("%s, owned by Cluster %s", strings.Join(patched, ", "), cluster.Name), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("cluster is joined with ID %s and API endpoint %s", opts.ClusterID, cluster.Spec.APIEndpoint)
+	if err = util2.RecordClusterEvent(ctx, controlPlaneKubeClient, cluster, corev1.EventTypeNormal, util2.EventReasonClusterJoined, message); err != nil {
+		logrus.Warn(err)
+	}
+	return nil
+}
+
+// newControlPlaneSecret returns the secret holding the credentials of member cluster in control plane.
+func newControlPlaneSecret(opts util2.ClusterRegisterOption) *corev1.Secret {
+	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: opts.ClusterNamespace,
 			Name:      opts.ClusterName,
 		},
 		Data: map[string][]byte{
-			SecretCADataKey: opts.Secret.Data["ca.crt"],
+			SecretCADataKey: opts.CABundle,
 			SecretTokenKey:  opts.Secret.Data[SecretTokenKey],
 		},
 	}
-	// 1、创建secret，在host集群中创建对应的secret
-	secret, err := util2.CreateSecret(controlPlaneKubeClient, secret)
-	if err != nil {
-		return fmt.Errorf("failed to create secret in control plane. error: %v", err)
-	}
-	opts.Secret = *secret
+}
 
-	// create secret to store impersonation info in control plane
-	impersonatorSecret := &corev1.Secret{
+// newControlPlaneImpersonatorSecret returns the secret holding the impersonator token of member cluster in control plane.
+func newControlPlaneImpersonatorSecret(opts util2.ClusterRegisterOption) *corev1.Secret {
+	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: opts.ClusterNamespace,
 			Name:      names2.GenerateImpersonationSecretName(opts.ClusterName),
@@ -222,49 +753,48 @@ func registerClusterInControllerPlane(opts util2.ClusterRegisterOption, controlP
 			SecretTokenKey: opts.ImpersonatorSecret.Data[SecretTokenKey],
 		},
 	}
-	//2、创建impersonatorSecret在 host集群中
-	impersonatorSecret, err = util2.CreateSecret(controlPlaneKubeClient, impersonatorSecret)
-	if err != nil {
-		return fmt.Errorf("failed to create impersonator secret in control plane. error: %v", err)
-	}
-	opts.ImpersonatorSecret = *impersonatorSecret
+}
 
-	// 创建集群
-	cluster, err := generateClusterInControllerPlane(opts)
-	if err != nil {
-		return err
-	}
-	patchSecretBody := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(cluster, clusterResourceKind),
-			},
-		},
-	}
-	err = util2.PatchSecret(controlPlaneKubeClient, impersonatorSecret.Namespace, impersonatorSecret.Name, types.MergePatchType, patchSecretBody)
-	if err != nil {
-		return fmt.Errorf("failed to patch impersonator secret %s/%s, error: %v", impersonatorSecret.Namespace, impersonatorSecret.Name, err)
-	}
-	err = util2.PatchSecret(controlPlaneKubeClient, secret.Namespace, secret.Name, types.MergePatchType, patchSecretBody)
+func generateClusterInControllerPlane(ctx context.Context, controlPlaneKarmadaClient *dynamic.DynamicClient, opts util2.ClusterRegisterOption) (*clusterv1alpha1.Cluster, util2.OperationResult, error) {
+	clusterObj := newClusterObject(opts)
+
+	cluster, result, err := util2.ApplyClusterObject(ctx, controlPlaneKarmadaClient, clusterObj, opts.ApplyOptions())
 	if err != nil {
-		return fmt.Errorf("failed to patch secret %s/%s, error: %v", secret.Namespace, secret.Name, err)
+		return nil, "", util2.ApplyConflictError(fmt.Sprintf("cluster(%s) object", opts.ClusterName), err)
 	}
-	return nil
+
+	return cluster, result, nil
 }
 
-func generateClusterInControllerPlane(opts util2.ClusterRegisterOption) (*clusterv1alpha1.Cluster, error) {
+// newClusterObject returns the Cluster object of member cluster in control plane.
+func newClusterObject(opts util2.ClusterRegisterOption) *clusterv1alpha1.Cluster {
 	clusterObj := &clusterv1alpha1.Cluster{}
+	clusterObj.APIVersion = SchemeGroupVersion.String()
+	clusterObj.Kind = clusterResourceKind.Kind
 	clusterObj.Name = opts.ClusterName
+	clusterObj.Labels = opts.Labels
+	clusterObj.Annotations = opts.Annotations
 	clusterObj.Spec.SyncMode = clusterv1alpha1.Push
 	clusterObj.Spec.APIEndpoint = opts.ClusterConfig.Host
 	clusterObj.Spec.ID = opts.ClusterID
-	clusterObj.Spec.SecretRef = &clusterv1alpha1.LocalSecretReference{
-		Namespace: opts.Secret.Namespace,
-		Name:      opts.Secret.Name,
+
+	// the address which control plane reaches the member cluster through may differ from ours.
+	if opts.ClusterAPIEndpoint != "" {
+		clusterObj.Spec.APIEndpoint = opts.ClusterAPIEndpoint
 	}
-	clusterObj.Spec.ImpersonatorSecretRef = &clusterv1alpha1.LocalSecretReference{
-		Namespace: opts.ImpersonatorSecret.Namespace,
-		Name:      opts.ImpersonatorSecret.Name,
+
+	if opts.IsKubeCredentialsEnabled() {
+		clusterObj.Spec.SecretRef = &clusterv1alpha1.LocalSecretReference{
+			Namespace: opts.Secret.Namespace,
+			Name:      opts.Secret.Name,
+		}
+	}
+
+	if opts.IsKubeImpersonatorEnabled() {
+		clusterObj.Spec.ImpersonatorSecretRef = &clusterv1alpha1.LocalSecretReference{
+			Namespace: opts.ImpersonatorSecret.Namespace,
+			Name:      opts.ImpersonatorSecret.Name,
+		}
 	}
 
 	if opts.ClusterProvider != "" {
@@ -279,77 +809,18 @@ func generateClusterInControllerPlane(opts util2.ClusterRegisterOption) (*cluste
 		clusterObj.Spec.Region = opts.ClusterRegion
 	}
 
-	if opts.ClusterConfig.TLSClientConfig.Insecure {
+	if opts.InsecureSkipTLSVerification {
 		clusterObj.Spec.InsecureSkipTLSVerification = true
 	}
 
-	if opts.ClusterConfig.Proxy != nil {
-		url, err := opts.ClusterConfig.Proxy(nil)
-		if err != nil {
-			return nil, fmt.Errorf("clusterConfig.Proxy error, %v", err)
+	if opts.ProxyServerAddress != "" {
+		clusterObj.Spec.ProxyURL = opts.ProxyServerAddress
+		if len(opts.ProxyHeader) > 0 {
+			clusterObj.Spec.ProxyHeader = opts.ProxyHeader
 		}
-		clusterObj.Spec.ProxyURL = url.String()
-	}
-
-	//controlPlaneKarmadaClient := karmadaclientset.NewForConfigOrDie(opts.ControlPlaneConfig)
-	controlPlaneKarmadaClient, err := dynamic.NewForConfig(opts.ControlPlaneConfig)
-	if err != nil {
-		panic(err.Error())
-	}
-	cluster, err := util2.CreateClusterObject(controlPlaneKarmadaClient, clusterObj)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cluster(%s) object. error: %v", opts.ClusterName, err)
-	}
-
-	return cluster, nil
-}
-
-// ensureClusterRoleBindingExist makes sure that the specific ClusterRoleBinding exist in cluster.
-// If ClusterRoleBinding not exit, just create it.
-func ensureClusterRoleBindingExist(client kubeclient.Interface, clusterRoleBinding *rbacv1.ClusterRoleBinding, dryRun bool) (*rbacv1.ClusterRoleBinding, error) {
-	if dryRun {
-		return clusterRoleBinding, nil
-	}
-
-	exist, err := util2.IsClusterRoleBindingExist(client, clusterRoleBinding.Name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check if ClusterRole exist. ClusterRole: %s, error: %v", clusterRoleBinding.Name, err)
-	}
-	if exist {
-		logrus.Infof("ensure ClusterRole succeed as already exist. ClusterRole: %s", clusterRoleBinding.Name)
-		return clusterRoleBinding, nil
-	}
-
-	createdObj, err := util2.CreateClusterRoleBinding(client, clusterRoleBinding)
-	if err != nil {
-		return nil, fmt.Errorf("ensure ClusterRole failed due to create failed. ClusterRole: %s, error: %v", clusterRoleBinding.Name, err)
-	}
-
-	return createdObj, nil
-}
-
-// ensureClusterRoleExist makes sure that the specific cluster role exist in cluster.
-// If cluster role not exit, just create it.
-func ensureClusterRoleExist(client kubeclient.Interface, clusterRole *rbacv1.ClusterRole, dryRun bool) (*rbacv1.ClusterRole, error) {
-	if dryRun {
-		return clusterRole, nil
-	}
-
-	exist, err := util2.IsClusterRoleExist(client, clusterRole.Name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check if ClusterRole exist. ClusterRole: %s, error: %v", clusterRole.Name, err)
-	}
-	if exist {
-		logrus.Infof("ensure ClusterRole succeed as already exist. ClusterRole: %s", clusterRole.Name)
-		return clusterRole, nil
-	}
-
-	createdObj, err := util2.CreateClusterRole(client, clusterRole)
-	if err != nil {
-		return nil, fmt.Errorf("ensure ClusterRole failed due to create failed. ClusterRole: %s, error: %v", clusterRole.Name, err)
 	}
 
-	return createdObj, nil
+	return clusterObj
 }
 
 // buildRoleBindingSubjects will generate a subject as per service account.
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+	names2 "ranzhouol/k8s_study/inspur/karmada/util/names"
+)
+
+// CredentialsRotatedAtAnnotation records when the credentials in the secret were rotated last time.
+const CredentialsRotatedAtAnnotation = "k8s-study.io/credentials-rotated-at"
+
+// rotateClusterCredentials mints new tokens for the ServiceAccounts of a push mode cluster, replaces
+// the tokens stored in control plane, and revokes the old tokens after the new ones are verified.
+func rotateClusterCredentials(ctx context.Context, controlPlaneRestConfig *rest.Config, clusterName, clusterNamespace string) error {
+	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(controlPlaneRestConfig)
+	karmadaClient, err := dynamic.NewForConfig(controlPlaneRestConfig)
+	if err != nil {
+		return err
+	}
+
+	cluster, exist, err := util2.GetClusterWithKarmadaClient(ctx, karmadaClient, clusterName)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return fmt.Errorf("cluster(%s) is not registered", clusterName)
+	}
+	return rotateCredentialsOfCluster(ctx, controlPlaneKubeClient, cluster, clusterNamespace)
+}
+
+func rotateCredentialsOfCluster(ctx context.Context, controlPlaneKubeClient kubeclient.Interface, cluster *clusterv1alpha1.Cluster, clusterNamespace string) (err error) {
+	if cluster.Spec.SyncMode != clusterv1alpha1.Push {
+		return fmt.Errorf("cluster(%s) is in %s mode, only push mode cluster is supported", cluster.Name, cluster.Spec.SyncMode)
+	}
+	if cluster.Spec.SecretRef == nil {
+		return fmt.Errorf("cluster(%s) has no secretRef", cluster.Name)
+	}
+	defer func() {
+		eventType, reason, message := corev1.EventTypeNormal, util2.EventReasonCredentialsRotated, "credentials are rotated"
+		if err != nil {
+			eventType, reason, message = corev1.EventTypeWarning, util2.EventReasonCredentialsRotationFailed, err.Error()
+		}
+		if recordErr := util2.RecordClusterEvent(ctx, controlPlaneKubeClient, cluster, eventType, reason, message); recordErr != nil {
+			logrus.Warn(recordErr)
+		}
+		err = recordAudit(&util2.AuditRecord{
+			Operation: "rotate-credentials",
+			Cluster:   cluster.Name,
+			Objects:   clusterSecretAuditObjects(cluster),
+		}, err)
+	}()
+
+	secret, err := controlPlaneKubeClient.CoreV1().Secrets(cluster.Spec.SecretRef.Namespace).Get(ctx, cluster.Spec.SecretRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	// the impersonator token is rotated first, as the member cluster is reached with the credentials
+	// in secret which will be revoked when rotating itself.
+	if cluster.Spec.ImpersonatorSecretRef != nil {
+		impersonatorSecret, err := controlPlaneKubeClient.CoreV1().Secrets(cluster.Spec.ImpersonatorSecretRef.Namespace).Get(ctx, cluster.Spec.ImpersonatorSecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		impersonationSA := &corev1.ServiceAccount{}
+		impersonationSA.Namespace = clusterNamespace
+		impersonationSA.Name = names2.GenerateServiceAccountName("impersonator")
+		if err = rotateServiceAccountToken(ctx, controlPlaneKubeClient, cluster, secret, impersonatorSecret, impersonationSA, false); err != nil {
+			return fmt.Errorf("failed to rotate impersonator credentials of cluster(%s), error: %v", cluster.Name, err)
+		}
+	}
+
+	serviceAccountObj := &corev1.ServiceAccount{}
+	serviceAccountObj.Namespace = clusterNamespace
+	serviceAccountObj.Name = names2.GenerateServiceAccountName(cluster.Name)
+	if err = rotateServiceAccountToken(ctx, controlPlaneKubeClient, cluster, secret, secret, serviceAccountObj, true); err != nil {
+		return fmt.Errorf("failed to rotate credentials of cluster(%s), error: %v", cluster.Name, err)
+	}
+
+	logrus.Infof("credentials of cluster(%s) are rotated successfully", cluster.Name)
+	return nil
+}
+
+// rotateServiceAccountToken replaces the token in targetSecret with a new token of the ServiceAccount.
+// The member cluster is accessed with the credentials in accessSecret.
+func rotateServiceAccountToken(ctx context.Context, controlPlaneKubeClient kubeclient.Interface, cluster *clusterv1alpha1.Cluster,
+	accessSecret, targetSecret *corev1.Secret, saObj *corev1.ServiceAccount, withCABundle bool) error {
+	clusterConfig, err := util2.BuildClusterConfig(cluster, accessSecret)
+	if err != nil {
+		return err
+	}
+	clusterKubeClient, err := kubeclient.NewForConfig(clusterConfig)
+	if err != nil {
+		return err
+	}
+
+	oldSecrets, err := util2.ListServiceAccountTokenSecrets(ctx, clusterKubeClient, saObj)
+	if err != nil {
+		return fmt.Errorf("failed to list token secrets of service account %s/%s, error: %v", saObj.Namespace, saObj.Name, err)
+	}
+
+	// 1、在成员集群中为 ServiceAccount 签发新的 token
+	newSecret, err := util2.CreateServiceAccountTokenSecret(ctx, clusterKubeClient, saObj, util2.DefaultServiceAccountSecretTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create token secret for service account %s/%s, error: %v", saObj.Namespace, saObj.Name, err)
+	}
+	logrus.Infof("new token secret %s/%s is issued in cluster(%s)", newSecret.Namespace, newSecret.Name, cluster.Name)
+
+	// the CA bundle may hold the CA from kubeconfig at join, so the new CA is merged into it.
+	caBundle := accessSecret.Data[util2.SecretCADataKey]
+	if withCABundle {
+		if caBundle, err = util2.MergeCABundle(targetSecret.Data[util2.SecretCADataKey], newSecret.Data[corev1.ServiceAccountRootCAKey]); err != nil {
+			return err
+		}
+	}
+
+	// 2、使用新的凭证访问成员集群进行验证，验证通过前不修改控制平面中的secret
+	verifySecret := accessSecret.DeepCopy()
+	verifySecret.Data = map[string][]byte{
+		util2.SecretTokenKey:  newSecret.Data[corev1.ServiceAccountTokenKey],
+		util2.SecretCADataKey: caBundle,
+	}
+	if err = verifyClusterCredentials(ctx, cluster, verifySecret); err != nil {
+		if deleteErr := util2.DeleteSecret(ctx, clusterKubeClient, newSecret.Namespace, newSecret.Name); deleteErr != nil {
+			logrus.Warnf("failed to delete the unverified token secret %s/%s, error: %v", newSecret.Namespace, newSecret.Name, deleteErr)
+		}
+		return fmt.Errorf("failed to verify the new credentials, secret %s/%s is not changed. error: %v", targetSecret.Namespace, targetSecret.Name, err)
+	}
+
+	// 3、原地更新控制平面中的secret
+	patchSecretBody := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				CredentialsRotatedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+		Data: map[string][]byte{
+			util2.SecretTokenKey: newSecret.Data[corev1.ServiceAccountTokenKey],
+		},
+	}
+	if withCABundle {
+		patchSecretBody.Data[util2.SecretCADataKey] = caBundle
+	}
+	err = util2.PatchSecret(ctx, controlPlaneKubeClient, targetSecret.Namespace, targetSecret.Name, types.MergePatchType, patchSecretBody)
+	if err != nil {
+		return fmt.Errorf("failed to patch secret %s/%s, error: %v", targetSecret.Namespace, targetSecret.Name, err)
+	}
+
+	// 4、验证通过后吊销旧的 token
+	oldToken := targetSecret.Data[util2.SecretTokenKey]
+	for _, oldSecret := range oldSecrets {
+		if !bytes.Equal(oldSecret.Data[corev1.ServiceAccountTokenKey], oldToken) {
+			continue
+		}
+		if err = util2.DeleteSecret(ctx, clusterKubeClient, oldSecret.Namespace, oldSecret.Name); err != nil {
+			return fmt.Errorf("failed to revoke old token secret %s/%s, error: %v", oldSecret.Namespace, oldSecret.Name, err)
+		}
+		logrus.Infof("old token secret %s/%s is revoked in cluster(%s)", oldSecret.Namespace, oldSecret.Name, cluster.Name)
+	}
+	return nil
+}
+
+// verifyClusterCredentials checks the credentials in secret by a discovery call to the member cluster.
+func verifyClusterCredentials(ctx context.Context, cluster *clusterv1alpha1.Cluster, secret *corev1.Secret) error {
+	clusterConfig, err := util2.BuildClusterConfig(cluster, secret)
+	if err != nil {
+		return err
+	}
+	return util2.CheckClusterConnectivity(ctx, clusterConfig, proxyCheckTimeout)
+}
+
+// rotateExpiredCredentials rotates the credentials of all push mode clusters which are older than olderThan.
+func rotateExpiredCredentials(ctx context.Context, controlPlaneRestConfig *rest.Config, clusterNamespace string, olderThan time.Duration) error {
+	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(controlPlaneRestConfig)
+	karmadaClient, err := dynamic.NewForConfig(controlPlaneRestConfig)
+	if err != nil {
+		return err
+	}
+
+	clusters, err := util2.ListClusters(ctx, karmadaClient)
+	if err != nil {
+		return err
+	}
+	util2.UpdateRegisteredClusters(clusters)
+
+	var errs []error
+	for i := range clusters {
+		cluster := &clusters[i]
+		if cluster.Spec.SyncMode != clusterv1alpha1.Push || cluster.Spec.SecretRef == nil {
+			continue
+		}
+
+		secret, err := controlPlaneKubeClient.CoreV1().Secrets(cluster.Spec.SecretRef.Namespace).Get(ctx, cluster.Spec.SecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if age := credentialsAge(secret); age < olderThan {
+			logrus.Infof("skip cluster(%s) as its credentials are %s old", cluster.Name, age.Round(time.Second))
+			continue
+		}
+
+		if err = rotateCredentialsOfCluster(ctx, controlPlaneKubeClient, cluster, clusterNamespace); err != nil {
+			logrus.Errorf("failed to rotate credentials of cluster(%s), error: %v", cluster.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// credentialsAge returns how long ago the credentials in secret were rotated or created.
+func credentialsAge(secret *corev1.Secret) time.Duration {
+	issuedAt := secret.CreationTimestamp.Time
+	if rotatedAt, ok := secret.Annotations[CredentialsRotatedAtAnnotation]; ok {
+		if t, err := time.Parse(time.RFC3339, rotatedAt); err == nil {
+			issuedAt = t
+		}
+	}
+	return time.Since(issuedAt)
+}
+
+// runScheduledRotation rotates the expired credentials every interval until ctx is done.
+func runScheduledRotation(ctx context.Context, controlPlaneRestConfig *rest.Config, clusterNamespace string, olderThan, interval time.Duration) {
+	wait.Until(func() {
+		if err := rotateExpiredCredentials(ctx, controlPlaneRestConfig, clusterNamespace, olderThan); err != nil {
+			logrus.Errorf("scheduled credentials rotation failed, error: %v", err)
+		}
+	}, interval, ctx.Done())
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+const (
+	// dryRunNone, dryRunClient and dryRunServer are the values of the --dry-run flag of join.
+	dryRunNone   = "none"
+	dryRunClient = "client"
+	dryRunServer = "server"
+
+	// dryRunPlaceholderToken fills the token of a secret whose ServiceAccount token is not issued yet.
+	dryRunPlaceholderToken = "dry-run-placeholder"
+)
+
+// dryRunStatus tells whether a check of server side dry-run ran and passed.
+type dryRunStatus string
+
+const (
+	dryRunPassed dryRunStatus = "passed"
+	dryRunFailed dryRunStatus = "failed"
+	// dryRunSkipped means the apiserver was not asked, as the object the check needs only exists in dry-run.
+	dryRunSkipped dryRunStatus = "skipped"
+)
+
+// dryRunResult is the result of sending the apply of an object in server side dry-run mode. Operation tells
+// whether the apply would create, update or leave the object unchanged.
+type dryRunResult struct {
+	Cluster   string                `json:"cluster"`
+	Kind      string                `json:"kind"`
+	Name      string                `json:"name"`
+	Operation util2.OperationResult `json:"operation,omitempty"`
+	Status    dryRunStatus          `json:"status"`
+	Message   string                `json:"message,omitempty"`
+}
+
+// dryRunReport holds the results of all the objects of join in server side dry-run mode.
+type dryRunReport struct {
+	ClusterName string         `json:"clusterName"`
+	Results     []dryRunResult `json:"results"`
+}
+
+// Passed tells if no apply failed, the skipped ones are not failures.
+func (r *dryRunReport) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status == dryRunFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// record adds the result of a dry-run apply.
+func (r *dryRunReport) record(cluster, kind, name string, operation util2.OperationResult, err error) {
+	result := dryRunResult{Cluster: cluster, Kind: kind, Name: name, Operation: operation, Status: dryRunPassed}
+	if err != nil {
+		result.Status = dryRunFailed
+		result.Message = err.Error()
+	}
+	r.Results = append(r.Results, result)
+}
+
+// skip adds a check that was not sent to the apiserver.
+func (r *dryRunReport) skip(cluster, kind, name, reason string) {
+	r.Results = append(r.Results, dryRunResult{Cluster: cluster, Kind: kind, Name: name, Status: dryRunSkipped, Message: reason})
+}
+
+// serverDryRunApply is how join applies its objects, sent in server side dry-run mode. The result is always
+// reported, as telling what join would change is the point of the dry-run.
+func serverDryRunApply(registerOption util2.ClusterRegisterOption) util2.ApplyOptions {
+	applyOptions := registerOption.ApplyOptions()
+	applyOptions.DryRun = true
+	applyOptions.ReportResult = true
+	return applyOptions
+}
+
+// serverDryRunJoin sends every apply of join to both clusters in server side dry-run mode, so that admission
+// webhooks, quotas and validations run for real against the new and the existing objects without persisting
+// anything.
+func serverDryRunJoin(ctx context.Context, controlPlaneRestConfig, clusterConfig *rest.Config, registerOption util2.ClusterRegisterOption) (*dryRunReport, error) {
+	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(controlPlaneRestConfig)
+	karmadaClient, err := dynamic.NewForConfig(controlPlaneRestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterKubeClient := kubeclient.NewForConfigOrDie(clusterConfig)
+
+	registerOption.ControlPlaneConfig = controlPlaneRestConfig
+	registerOption.ClusterConfig = clusterConfig
+	id, err := validateJoin(ctx, clusterKubeClient, registerOption)
+	if err != nil {
+		return nil, err
+	}
+	if err = prepareJoin(ctx, clusterKubeClient, karmadaClient, id, &registerOption); err != nil {
+		return nil, err
+	}
+
+	report := &dryRunReport{ClusterName: registerOption.ClusterName}
+	objects := newMemberClusterObjects(registerOption)
+	applyOptions := serverDryRunApply(registerOption)
+
+	// objects in member cluster
+	_, result, err := util2.ApplyNamespace(ctx, clusterKubeClient, registerOption.ClusterNamespace, applyOptions)
+	report.record(planClusterMember, "Namespace", registerOption.ClusterNamespace, result, err)
+
+	tokens := map[string]*corev1.Secret{}
+	for _, sa := range []*corev1.ServiceAccount{objects.serviceAccount, objects.impersonationSA} {
+		liveSA, result, err := util2.ApplyServiceAccount(ctx, clusterKubeClient, sa, applyOptions)
+		report.record(planClusterMember, "ServiceAccount", sa.Name, result, err)
+
+		// the token of an existing ServiceAccount is reused by join, found the same way as join waits for it.
+		if err == nil && result != util2.OperationResultCreated {
+			if tokens[sa.Name], err = util2.NewServiceAccountSecretWaiter(clusterKubeClient, 0).Lookup(ctx, liveSA); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, result, err = util2.ApplyClusterRole(ctx, clusterKubeClient, objects.clusterRole, applyOptions)
+	report.record(planClusterMember, "ClusterRole", objects.clusterRole.Name, result, err)
+
+	_, result, err = util2.ApplyClusterRoleBinding(ctx, clusterKubeClient, objects.clusterRoleBinding, applyOptions)
+	report.record(planClusterMember, "ClusterRoleBinding", objects.clusterRoleBinding.Name, result, err)
+
+	// objects in control plane
+	_, result, err = util2.ApplyNamespace(ctx, controlPlaneKubeClient, registerOption.ClusterNamespace, applyOptions)
+	report.record(planClusterControlPlane, "Namespace", registerOption.ClusterNamespace, result, err)
+
+	var secrets []*corev1.Secret
+	if registerOption.IsKubeCredentialsEnabled() {
+		registerOption.Secret = dryRunTokenSecret(tokens[objects.serviceAccount.Name])
+		// the kubeconfig CA is merged the same way as join, so that an unchanged secret is not reported updated.
+		if registerOption.CABundle, err = mergeClusterCABundle(registerOption); err != nil {
+			return nil, err
+		}
+		secret := newControlPlaneSecret(registerOption)
+		secrets = append(secrets, secret)
+		registerOption.Secret.ObjectMeta = secret.ObjectMeta
+	}
+	if registerOption.IsKubeImpersonatorEnabled() {
+		registerOption.ImpersonatorSecret = dryRunTokenSecret(tokens[objects.impersonationSA.Name])
+		secret := newControlPlaneImpersonatorSecret(registerOption)
+		secrets = append(secrets, secret)
+		registerOption.ImpersonatorSecret.ObjectMeta = secret.ObjectMeta
+	}
+	// the secrets of an existing Cluster are applied with their owner references at once, the same as join.
+	existingCluster, clusterExist, err := util2.GetClusterWithKarmadaClient(ctx, karmadaClient, registerOption.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	existingSecrets := map[string]bool{}
+	for _, secret := range secrets {
+		if clusterExist {
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(existingCluster, clusterResourceKind)}
+		}
+		_, result, err = util2.ApplySecret(ctx, controlPlaneKubeClient, secret, applyOptions)
+		report.record(planClusterControlPlane, "Secret", secret.Name, result, err)
+		existingSecrets[secret.Name] = err == nil && result != util2.OperationResultCreated
+	}
+
+	clusterObj := newClusterObject(registerOption)
+	cluster, result, err := util2.ApplyClusterObject(ctx, karmadaClient, clusterObj, applyOptions)
+	report.record(planClusterControlPlane, clusterResourceKind.Kind, clusterObj.Name, result, err)
+	if err != nil || clusterExist {
+		return report, nil
+	}
+
+	// the owner references can only be applied to the secrets which exist already.
+	for _, secret := range secrets {
+		if !existingSecrets[secret.Name] {
+			logrus.Infof("skip applying owner references to secret %s/%s as it is only created in dry-run", secret.Namespace, secret.Name)
+			report.skip(planClusterControlPlane, "Secret", secret.Name, "owner references are not checked, the secret is only created in dry-run")
+			continue
+		}
+		secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(cluster, clusterResourceKind)}
+		_, result, err = util2.ApplySecret(ctx, controlPlaneKubeClient, secret, applyOptions)
+		report.record(planClusterControlPlane, "Secret", secret.Name, result, err)
+	}
+
+	return report, nil
+}
+
+// dryRunTokenSecret returns the token secret of a ServiceAccount, or a placeholder if it's not issued yet.
+func dryRunTokenSecret(tokenSecret *corev1.Secret) corev1.Secret {
+	if tokenSecret != nil {
+		return *tokenSecret
+	}
+	return corev1.Secret{
+		Data: map[string][]byte{
+			SecretTokenKey: []byte(dryRunPlaceholderToken),
+		},
+	}
+}
+
+// validateDryRun checks the value of --dry-run flag.
+func validateDryRun(dryRun string) error {
+	switch dryRun {
+	case dryRunNone, dryRunClient, dryRunServer:
+		return nil
+	}
+	return fmt.Errorf("invalid dry-run value %q, should be %s, %s or %s", dryRun, dryRunNone, dryRunClient, dryRunServer)
+}
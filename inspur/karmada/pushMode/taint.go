@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	util2 "ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+// newKarmadaClientFromFlags parses the flags and builds the dynamic client of karmada control plane.
+func newKarmadaClientFromFlags(flags *flag.FlagSet, karmadaConfigPath *string, args []string) (*dynamic.DynamicClient, error) {
+	if err := parseCommandFlags(flags, args); err != nil {
+		return nil, err
+	}
+
+	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", *karmadaConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(karmadaConfig)
+}
+
+// expireAtFrom returns the expiry time after d, or nil if d is zero.
+func expireAtFrom(d time.Duration) *time.Time {
+	if d <= 0 {
+		return nil
+	}
+	expireAt := time.Now().Add(d)
+	return &expireAt
+}
+
+// recordTaintAudit audits the change of taints on the cluster.
+func recordTaintAudit(operation, clusterName, taints string, err error) error {
+	return recordAudit(&util2.AuditRecord{
+		Operation: operation,
+		Cluster:   clusterName,
+		Objects:   []string{util2.AuditObject("Cluster", "", clusterName)},
+		Details:   map[string]string{"taints": taints},
+	}, err)
+}
+
+// runTaint adds, removes or lists the taints of a cluster.
+func runTaint(ctx context.Context, args []string) error {
+	flags, karmadaConfigPath, _ := newCommandFlagSet("taint")
+	clusterName := flags.String("cluster-name", "", "name of the cluster")
+	add := flags.String("add", "", "taint to add, in the form of key=value:effect")
+	remove := flags.String("remove", "", "taint to remove, in the form of key:effect, or key to remove all effects")
+	expireAfter := flags.Duration("expire-after", 0, "remove the added taint after this duration, never expires if not set")
+	karmadaClient, err := newKarmadaClientFromFlags(flags, karmadaConfigPath, args)
+	if err != nil {
+		return err
+	}
+	if *clusterName == "" {
+		return fmt.Errorf("--cluster-name is required")
+	}
+
+	switch {
+	case *add != "":
+		taint, err := util2.ParseTaint(*add)
+		if err != nil {
+			return err
+		}
+		err = util2.AddClusterTaint(ctx, karmadaClient, *clusterName, taint, expireAtFrom(*expireAfter))
+		if err = recordTaintAudit("taint-add", *clusterName, *add, err); err != nil {
+			return err
+		}
+		fmt.Printf("cluster(%s) tainted with %s\n", *clusterName, *add)
+	case *remove != "":
+		key, effect := *remove, corev1.TaintEffect("")
+		if index := strings.LastIndex(*remove, ":"); index >= 0 {
+			key, effect = (*remove)[:index], corev1.TaintEffect((*remove)[index+1:])
+		}
+		err = util2.RemoveClusterTaint(ctx, karmadaClient, *clusterName, key, effect)
+		if err = recordTaintAudit("taint-remove", *clusterName, *remove, err); err != nil {
+			return err
+		}
+		fmt.Printf("taint %s removed from cluster(%s)\n", *remove, *clusterName)
+	default:
+		taints, err := util2.ListClusterTaints(ctx, karmadaClient, *clusterName)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tEFFECT")
+		for _, taint := range taints {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", taint.Key, taint.Value, taint.Effect)
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+// runMaintenanceTaint adds the maintenance taint with effect to a cluster, it's the shorthand of cordon and drain.
+func runMaintenanceTaint(ctx context.Context, command string, effect corev1.TaintEffect, args []string) error {
+	flags, karmadaConfigPath, _ := newCommandFlagSet(command)
+	clusterName := flags.String("cluster-name", "", "name of the cluster")
+	expireAfter := flags.Duration("expire-after", 0, "end the maintenance after this duration, never expires if not set")
+	karmadaClient, err := newKarmadaClientFromFlags(flags, karmadaConfigPath, args)
+	if err != nil {
+		return err
+	}
+	if *clusterName == "" {
+		return fmt.Errorf("--cluster-name is required")
+	}
+
+	taint := corev1.Taint{Key: util2.MaintenanceTaintKey, Effect: effect}
+	err = util2.AddClusterTaint(ctx, karmadaClient, *clusterName, taint, expireAtFrom(*expireAfter))
+	if err = recordTaintAudit(command, *clusterName, taint.ToString(), err); err != nil {
+		return err
+	}
+	fmt.Printf("cluster(%s) %sed\n", *clusterName, command)
+	return nil
+}
+
+// runUncordon removes the maintenance taints added by cordon and drain from a cluster.
+func runUncordon(ctx context.Context, args []string) error {
+	flags, karmadaConfigPath, _ := newCommandFlagSet("uncordon")
+	clusterName := flags.String("cluster-name", "", "name of the cluster")
+	karmadaClient, err := newKarmadaClientFromFlags(flags, karmadaConfigPath, args)
+	if err != nil {
+		return err
+	}
+	if *clusterName == "" {
+		return fmt.Errorf("--cluster-name is required")
+	}
+
+	err = util2.RemoveClusterTaint(ctx, karmadaClient, *clusterName, util2.MaintenanceTaintKey, "")
+	if err = recordTaintAudit("uncordon", *clusterName, util2.MaintenanceTaintKey, err); err != nil {
+		return err
+	}
+	fmt.Printf("cluster(%s) uncordoned\n", *clusterName)
+	return nil
+}
+
+// runExpireTaints removes the expired taints from all the clusters periodically.
+func runExpireTaints(ctx context.Context, args []string) error {
+	flags, karmadaConfigPath, _ := newCommandFlagSet("expire-taints")
+	interval := flags.Duration("interval", time.Minute, "interval between two rounds of checking")
+	karmadaClient, err := newKarmadaClientFromFlags(flags, karmadaConfigPath, args)
+	if err != nil {
+		return err
+	}
+
+	wait.Until(func() {
+		removed, err := util2.RemoveExpiredClusterTaints(ctx, karmadaClient, time.Now())
+		if err != nil {
+			logrus.Errorf("failed to remove expired taints, error: %v", err)
+		}
+		for clusterName, taints := range removed {
+			if err = recordTaintAudit("expire-taints", clusterName, strings.Join(taints, ","), nil); err != nil {
+				logrus.Error(err)
+			}
+		}
+	}, *interval, ctx.Done())
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// tokenSyncController watches the ServiceAccounts of the dashboards and their token secrets in control plane,
+// and the secrets on the host cluster, and syncs the host secret of an instance whenever any of its objects
+// changes.
+type tokenSyncController struct {
+	syncer    *tokenSyncer
+	instances map[string]dashboardInstance
+	queue     workqueue.RateLimitingInterface
+
+	// the informers are scoped to the namespaces of the instances.
+	informerFactories []informers.SharedInformerFactory
+	cacheSyncs        []cache.InformerSynced
+}
+
+// newTokenSyncController returns the controller, the informers resync every resyncPeriod so that a missed
+// change is fixed eventually.
+func newTokenSyncController(syncer *tokenSyncer, instances []dashboardInstance, resyncPeriod time.Duration) *tokenSyncController {
+	c := &tokenSyncController{
+		syncer:    syncer,
+		instances: map[string]dashboardInstance{},
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	namespaces := map[string]bool{}
+	for _, instance := range instances {
+		c.instances[instance.key()] = instance
+		namespaces[instance.Namespace] = true
+	}
+
+	for namespace := range namespaces {
+		controlPlaneInformers := informers.NewSharedInformerFactoryWithOptions(syncer.controlPlaneClient, resyncPeriod, informers.WithNamespace(namespace))
+		hostInformers := informers.NewSharedInformerFactoryWithOptions(syncer.hostClient, resyncPeriod, informers.WithNamespace(namespace))
+
+		serviceAccountInformer := controlPlaneInformers.Core().V1().ServiceAccounts().Informer()
+		serviceAccountInformer.AddEventHandler(c.handler(func(obj interface{}, instance dashboardInstance) bool {
+			serviceAccount, ok := obj.(*corev1.ServiceAccount)
+			return ok && serviceAccount.Namespace == instance.Namespace && serviceAccount.Name == instance.ServiceAccount
+		}))
+		secretInformer := controlPlaneInformers.Core().V1().Secrets().Informer()
+		secretInformer.AddEventHandler(c.handler(func(obj interface{}, instance dashboardInstance) bool {
+			secret, ok := obj.(*corev1.Secret)
+			return ok && secret.Namespace == instance.Namespace && secret.Type == corev1.SecretTypeServiceAccountToken &&
+				secret.Annotations[corev1.ServiceAccountNameKey] == instance.ServiceAccount
+		}))
+		hostSecretInformer := hostInformers.Core().V1().Secrets().Informer()
+		hostSecretInformer.AddEventHandler(c.handler(func(obj interface{}, instance dashboardInstance) bool {
+			secret, ok := obj.(*corev1.Secret)
+			return ok && secret.Namespace == instance.Namespace && secret.Name == instance.SecretName
+		}))
+
+		c.informerFactories = append(c.informerFactories, controlPlaneInformers, hostInformers)
+		c.cacheSyncs = append(c.cacheSyncs, serviceAccountInformer.HasSynced, secretInformer.HasSynced, hostSecretInformer.HasSynced)
+	}
+	return c
+}
+
+// handler enqueues the instances the changed object belongs to, the tombstone of a deleted object is
+// unwrapped.
+func (c *tokenSyncController) handler(belongsTo func(obj interface{}, instance dashboardInstance) bool) cache.ResourceEventHandler {
+	enqueue := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		for key, instance := range c.instances {
+			if belongsTo(obj, instance) {
+				c.queue.Add(key)
+			}
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, newObj interface{}) { enqueue(newObj) },
+		DeleteFunc: enqueue,
+	}
+}
+
+// Run syncs the host secrets on every change until ctx is done. The failed syncs are retried with backoff.
+func (c *tokenSyncController) Run(ctx context.Context) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	for _, factory := range c.informerFactories {
+		factory.Start(ctx.Done())
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), c.cacheSyncs...) {
+		return fmt.Errorf("failed to wait for the caches of token sync controller to sync")
+	}
+	for key, instance := range c.instances {
+		logrus.Infof("token sync controller started, syncing instance %s", instance)
+		c.queue.Add(key)
+	}
+
+	go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	<-ctx.Done()
+	return nil
+}
+
+func (c *tokenSyncController) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *tokenSyncController) processNextItem(ctx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	instance := c.instances[key.(string)]
+	if err := c.syncer.sync(ctx, instance); err != nil {
+		logrus.Errorf("failed to sync secret %s/%s, retry later. error: %v", instance.Namespace, instance.SecretName, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultDashboardInstance is the dashboard synced if no --instance is given.
+var defaultDashboardInstance = dashboardInstance{
+	Namespace:      "karmada-system",
+	ServiceAccount: "karmada-dashboard",
+	SecretName:     "karmada-dashboard-token",
+}
+
+// dashboardInstance is a karmada-dashboard whose ServiceAccount in control plane is synced to a secret on
+// the karmada host cluster, in the namespace of the same name.
+type dashboardInstance struct {
+	// Namespace is the namespace of the ServiceAccount in control plane, and the namespace of the secret on
+	// the host cluster.
+	Namespace      string
+	ServiceAccount string
+	SecretName     string
+}
+
+// key is the key of the instance in the work queue.
+func (i dashboardInstance) key() string {
+	return fmt.Sprintf("%s/%s", i.Namespace, i.SecretName)
+}
+
+func (i dashboardInstance) String() string {
+	return fmt.Sprintf("%s/%s/%s", i.Namespace, i.ServiceAccount, i.SecretName)
+}
+
+// parseDashboardInstance parses an instance in the form of namespace/serviceaccount[/secret], the secret is
+// named after the ServiceAccount with a -token suffix if it's omitted.
+func parseDashboardInstance(value string) (dashboardInstance, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return dashboardInstance{}, fmt.Errorf("invalid instance %q, should be namespace/serviceaccount[/secret]", value)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return dashboardInstance{}, fmt.Errorf("invalid instance %q, should be namespace/serviceaccount[/secret]", value)
+		}
+	}
+	instance := dashboardInstance{Namespace: parts[0], ServiceAccount: parts[1], SecretName: parts[1] + "-token"}
+	if len(parts) == 3 {
+		instance.SecretName = parts[2]
+	}
+	return instance, nil
+}
+
+// instancesFlag collects the repeated --instance flags.
+type instancesFlag []dashboardInstance
+
+func (f *instancesFlag) String() string {
+	values := make([]string, 0, len(*f))
+	for _, instance := range *f {
+		values = append(values, instance.String())
+	}
+	return strings.Join(values, ",")
+}
+
+func (f *instancesFlag) Set(value string) error {
+	instance, err := parseDashboardInstance(value)
+	if err != nil {
+		return err
+	}
+	for _, existing := range *f {
+		if existing.key() == instance.key() {
+			return fmt.Errorf("secret %s is synced by more than one instance", instance.key())
+		}
+	}
+	*f = append(*f, instance)
+	return nil
+}
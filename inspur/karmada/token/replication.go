@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+// runReplication replicates the secrets of the spec once, or until ctx is done with watch. With dryRun the
+// drifted targets are only reported.
+func runReplication(ctx context.Context, specPath string, auditLog *util.AuditLog, watch, dryRun bool, resyncPeriod time.Duration) error {
+	spec, err := util.LoadReplicationSpec(specPath)
+	if err != nil {
+		return err
+	}
+	replicator, err := util.NewSecretReplicator(spec, auditLog)
+	if err != nil {
+		return err
+	}
+	replicator.DryRun = dryRun
+	if watch {
+		return replicator.Watch(ctx, resyncPeriod)
+	}
+
+	results, err := replicator.ReplicateAll(ctx)
+	for _, result := range results {
+		switch {
+		case dryRun && result.Operation == util.OperationResultCreated:
+			logrus.Infof("replication %s: target secret is missing", result.Replication)
+		case dryRun && result.Operation == util.OperationResultUpdated:
+			logrus.Infof("replication %s: target secret drifted on keys %v", result.Replication, result.DriftedKeys)
+		default:
+			logrus.Infof("replication %s: target secret %s", result.Replication, result.Operation)
+		}
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"ranzhouol/k8s_study/inspur/karmada/util"
+)
+
+// syncConditionAnnotation holds the Synced condition of the host secret as JSON, it tells if the token is in
+// sync with the ServiceAccount in control plane and why not.
+const syncConditionAnnotation = "k8s-study.io/token-sync-condition"
+
+// conditionTypeSynced is the type of the condition recorded in syncConditionAnnotation.
+const conditionTypeSynced = "Synced"
+
+// The reasons of the Synced condition.
+const (
+	reasonTokenSynced            = "TokenSynced"
+	reasonServiceAccountNotFound = "ServiceAccountNotFound"
+	reasonTokenSecretNotFound    = "TokenSecretNotFound"
+	reasonKubeconfigInvalid      = "KubeconfigInvalid"
+	reasonTokenRequestFailed     = "TokenRequestFailed"
+	reasonSyncFailed             = "SyncFailed"
+)
+
+// kubeconfigName names the cluster, user and context of the kubeconfig generated for the dashboards.
+const kubeconfigName = "karmada-apiserver"
+
+// tokenSyncer copies the token of the ServiceAccount of a dashboard in control plane to a secret on the
+// karmada host cluster, along with a kubeconfig reaching control plane with the token.
+type tokenSyncer struct {
+	controlPlaneClient kubeclient.Interface
+	hostClient         kubeclient.Interface
+	// controlPlaneServer is the address of the karmada apiserver written to the kubeconfig.
+	controlPlaneServer string
+	auditLog           *util.AuditLog
+}
+
+// sync makes the host secret of the instance hold the token of its ServiceAccount and the kubeconfig built
+// from it, the host secret is created again if it's deleted. The result is recorded as the Synced condition
+// of the host secret.
+func (s *tokenSyncer) sync(ctx context.Context, instance dashboardInstance) error {
+	data, reason, err := s.desiredData(ctx, instance)
+	if err != nil {
+		s.recordFailure(ctx, instance, reason, err)
+		return err
+	}
+	return s.writeHostSecret(ctx, instance, data)
+}
+
+// writeHostSecret writes data to the host secret of the instance and records the Synced condition, nothing is
+// written if the secret already holds the data.
+func (s *tokenSyncer) writeHostSecret(ctx context.Context, instance dashboardInstance, data map[string][]byte) error {
+	hostSecret, err := s.hostClient.CoreV1().Secrets(instance.Namespace).Get(ctx, instance.SecretName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	condition := metav1.Condition{
+		Type:    conditionTypeSynced,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonTokenSynced,
+		Message: fmt.Sprintf("token of service account %s/%s is synced", instance.Namespace, instance.ServiceAccount),
+	}
+	var conditions []metav1.Condition
+	if err == nil {
+		conditions = syncConditions(hostSecret)
+	}
+	conditionChanged := setSyncCondition(&conditions, condition)
+	if err == nil && containsData(hostSecret, data) && !conditionChanged {
+		return nil
+	}
+
+	annotation, err := json.Marshal(conditions)
+	if err != nil {
+		return err
+	}
+	karmadaHostPlaneSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        instance.SecretName,
+			Namespace:   instance.Namespace,
+			Annotations: map[string]string{syncConditionAnnotation: string(annotation)},
+		},
+		Data: data,
+	}
+	logrus.Infof("在 karmada Host 平面同步secret %s/%s", instance.Namespace, instance.SecretName)
+	_, _, err = util.ApplySecret(ctx, s.hostClient, karmadaHostPlaneSecret, util.ApplyOptions{Force: true})
+	s.audit(instance, err)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("secret: %s/%s 同步成功", instance.Namespace, instance.SecretName)
+	return nil
+}
+
+// desiredData returns the data of the host secret built from the token secret of the ServiceAccount in
+// control plane, or the reason why it can not be built.
+func (s *tokenSyncer) desiredData(ctx context.Context, instance dashboardInstance) (map[string][]byte, string, error) {
+	serviceAccount, err := s.controlPlaneClient.CoreV1().ServiceAccounts(instance.Namespace).Get(ctx, instance.ServiceAccount, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, reasonServiceAccountNotFound, err
+	}
+	if err != nil {
+		return nil, reasonSyncFailed, err
+	}
+	karmadaControlPlaneSecret, err := util.GetServiceAccountTokenSecret(ctx, s.controlPlaneClient, serviceAccount)
+	if apierrors.IsNotFound(err) {
+		return nil, reasonTokenSecretNotFound, err
+	}
+	if err != nil {
+		return nil, reasonSyncFailed, err
+	}
+
+	data, err := s.hostSecretData(karmadaControlPlaneSecret.Data[corev1.ServiceAccountTokenKey], karmadaControlPlaneSecret.Data[corev1.ServiceAccountRootCAKey])
+	if err != nil {
+		return nil, reasonKubeconfigInvalid, fmt.Errorf("failed to build kubeconfig from secret %s/%s, error: %v",
+			karmadaControlPlaneSecret.Namespace, karmadaControlPlaneSecret.Name, err)
+	}
+	return data, "", nil
+}
+
+// hostSecretData returns the data of the host secret holding the token and the kubeconfig built from it.
+func (s *tokenSyncer) hostSecretData(token, caData []byte) (map[string][]byte, error) {
+	kubeconfig, err := util.BuildTokenKubeconfig(kubeconfigName, s.controlPlaneServer, caData, token)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		corev1.ServiceAccountTokenKey: token,
+		util.SecretKubeconfigKey:      kubeconfig,
+	}, nil
+}
+
+// recordFailure records the failure as the Synced condition of the host secret if it exists, the data in
+// it is kept.
+func (s *tokenSyncer) recordFailure(ctx context.Context, instance dashboardInstance, reason string, syncErr error) {
+	hostSecret, err := s.hostClient.CoreV1().Secrets(instance.Namespace).Get(ctx, instance.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	conditions := syncConditions(hostSecret)
+	if !setSyncCondition(&conditions, metav1.Condition{
+		Type:    conditionTypeSynced,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: syncErr.Error(),
+	}) {
+		return
+	}
+
+	annotation, err := json.Marshal(conditions)
+	if err != nil {
+		return
+	}
+	patch := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{syncConditionAnnotation: string(annotation)}}}
+	if err = util.PatchSecret(ctx, s.hostClient, instance.Namespace, instance.SecretName, types.MergePatchType, patch); err != nil {
+		logrus.Errorf("failed to record the sync condition of secret %s/%s, error: %v", instance.Namespace, instance.SecretName, err)
+	}
+}
+
+// audit records the write of the host secret.
+func (s *tokenSyncer) audit(instance dashboardInstance, err error) {
+	record := &util.AuditRecord{
+		Operation: "sync-karmada-token",
+		Actor:     util.AuditActor(),
+		Objects:   []string{util.AuditObject("Secret", instance.Namespace, instance.SecretName)},
+	}
+	record.Finish(err)
+	if auditErr := s.auditLog.Append(record); auditErr != nil {
+		logrus.Error(auditErr.Error())
+	}
+}
+
+// containsData tells if the secret holds all the data, the keys not synced are ignored.
+func containsData(secret *corev1.Secret, data map[string][]byte) bool {
+	for key, value := range data {
+		if !bytes.Equal(secret.Data[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncConditions returns the conditions recorded on the host secret, an invalid annotation is ignored.
+func syncConditions(secret *corev1.Secret) []metav1.Condition {
+	var conditions []metav1.Condition
+	if value, ok := secret.Annotations[syncConditionAnnotation]; ok {
+		if err := json.Unmarshal([]byte(value), &conditions); err != nil {
+			logrus.Warnf("ignoring the invalid annotation %s of secret %s/%s, error: %v", syncConditionAnnotation, secret.Namespace, secret.Name, err)
+			return nil
+		}
+	}
+	return conditions
+}
+
+// setSyncCondition sets the condition, the transition time is kept if the status does not change. It tells if
+// the conditions are changed.
+func setSyncCondition(conditions *[]metav1.Condition, condition metav1.Condition) bool {
+	existing := meta.FindStatusCondition(*conditions, condition.Type)
+	if existing != nil && existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return false
+	}
+	meta.SetStatusCondition(conditions, condition)
+	return true
+}
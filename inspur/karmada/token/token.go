@@ -2,83 +2,148 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/sirupsen/logrus"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/clock"
 	"ranzhouol/k8s_study/inspur/karmada/util"
 )
 
-const (
-	// karmadaSecretName is the name of the secret on karmada host platform
-	karmadaSecretName = "karmada-dashboard-token"
-
-	// karmadaSecretNamespace is the name of the Namespace in which secret resides
-	karmadaSecretNamespace = "karmada-system"
-
-	// karmadaServiceAccount is the name of the karmada-dashboard's ServiceAccount
-	karmadaServiceAccount = "karmada-dashboard"
-)
-
 func main() {
-	karmadaConfigPath := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\karmada-apiserver.config"
-	kubeconfigPath := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\config"
-
-	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", karmadaConfigPath)
-	if err != nil {
-		panic(err.Error())
-	}
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		panic(err.Error())
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	auditLogPath := flag.String("audit-log", util.DefaultAuditLogPath, "path to the append-only audit log of state changing operations")
+	watch := flag.Bool("watch", false, "keep the host secret in sync with the token of the ServiceAccount until interrupted, instead of syncing it once")
+	resyncPeriod := flag.Duration("resync-period", 10*time.Minute, "interval to sync the host secret again with --watch, even if nothing changes")
+	tokenRequest := flag.Bool("token-request", false, "request short-lived tokens with the TokenRequest API and refresh them until interrupted, "+
+		"instead of copying the token secrets of the ServiceAccounts")
+	tokenExpiration := flag.Duration("token-expiration", time.Hour, "requested lifetime of the tokens with --token-request, a token is refreshed at 80% of it")
+	tokenAudiences := flag.String("token-audiences", "", "comma separated audiences of the tokens with --token-request, defaults to the audience of karmada apiserver")
+	replicationSpec := flag.String("replication-spec", "", "YAML spec of the secrets to replicate across clusters, replaces the dashboard token sync when given")
+	dryRun := flag.Bool("dry-run", false, "only report the drifted target secrets with --replication-spec, nothing is written")
+	var instances instancesFlag
+	flag.Var(&instances, "instance", fmt.Sprintf("dashboard to sync in the form of namespace/serviceaccount[/secret], can be repeated, defaults to %s", defaultDashboardInstance))
+	flag.Parse()
+	if len(instances) == 0 {
+		instances = instancesFlag{defaultDashboardInstance}
 	}
 
-	err = createKarmadaToken(karmadaConfig, config)
+	var err error
+	if err = validateFlags(setFlags()); err == nil {
+		if *replicationSpec != "" {
+			err = runReplication(ctx, *replicationSpec, util.NewAuditLog(*auditLogPath), *watch, *dryRun, *resyncPeriod)
+		} else {
+			err = runTokenSync(ctx, util.NewAuditLog(*auditLogPath), instances, *watch, *resyncPeriod, *tokenRequest, *tokenExpiration, *tokenAudiences)
+		}
+	}
 	if err != nil {
 		logrus.Error(err.Error())
+		cancel()
+		os.Exit(1)
 	}
 }
 
-func createKarmadaToken(karmadaConfig, config *rest.Config) error {
-	controlPlaneKubeClient := kubeclient.NewForConfigOrDie(karmadaConfig)
-	clusterKubeClient := kubeclient.NewForConfigOrDie(config)
+// setFlags returns the names of the flags set on the command line.
+func setFlags() map[string]bool {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
 
-	// 判断secret是否存在
-	ok, err := util.IfSecretExists(clusterKubeClient, karmadaSecretNamespace, karmadaSecretName)
-	if err != nil {
-		return err
+// flagRequirements maps a flag to the flag it only applies with.
+var flagRequirements = map[string]string{
+	"resync-period":    "watch",
+	"token-expiration": "token-request",
+	"token-audiences":  "token-request",
+	"dry-run":          "replication-spec",
+}
+
+// flagConflicts are the pairs of flags selecting different modes, which can not be set together.
+var flagConflicts = [][2]string{
+	{"token-request", "watch"},
+	{"replication-spec", "token-request"},
+	{"replication-spec", "instance"},
+}
+
+// validateFlags rejects the flags set together that select conflicting modes, and the flags set without the
+// mode they apply to, so that a mistaken command fails instead of silently doing something else.
+func validateFlags(set map[string]bool) error {
+	for _, pair := range flagConflicts {
+		if set[pair[0]] && set[pair[1]] {
+			return fmt.Errorf("--%s and --%s can not be set together", pair[0], pair[1])
+		}
 	}
-	if ok {
-		logrus.Info("karmadaHost secret 已经存在")
-		return nil
+	for name, required := range flagRequirements {
+		if set[name] && !set[required] {
+			return fmt.Errorf("--%s only applies with --%s", name, required)
+		}
 	}
+	return nil
+}
+
+// runTokenSync syncs the host secrets of the dashboard instances once, or until ctx is done with watch or
+// tokenRequest.
+func runTokenSync(ctx context.Context, auditLog *util.AuditLog, instances []dashboardInstance, watch bool, resyncPeriod time.Duration,
+	tokenRequest bool, tokenExpiration time.Duration, tokenAudiences string) error {
+	karmadaConfigPath := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\karmada-apiserver.config"
+	kubeconfigPath := "D:\\Go\\Go_WorkSpace\\src\\inspur.com\\linux\\5174\\config"
 
-	// 获取karmada控制平台上的secret
-	serviceAccount, err := controlPlaneKubeClient.CoreV1().ServiceAccounts(karmadaSecretNamespace).Get(context.TODO(), karmadaServiceAccount, metav1.GetOptions{})
+	karmadaConfig, err := clientcmd.BuildConfigFromFlags("", karmadaConfigPath)
 	if err != nil {
 		return err
 	}
-	karmadaControlPlaneSecret, err := util.GetTargetSecret(controlPlaneKubeClient, serviceAccount.Secrets, corev1.SecretTypeServiceAccountToken, karmadaSecretNamespace)
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
 		return err
 	}
 
-	karmadaHostPlaneSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      karmadaSecretName,
-			Namespace: karmadaSecretNamespace,
-		},
-		Data: map[string][]byte{
-			"token": karmadaControlPlaneSecret.Data["token"],
-		},
+	syncer := &tokenSyncer{
+		controlPlaneClient: kubeclient.NewForConfigOrDie(karmadaConfig),
+		hostClient:         kubeclient.NewForConfigOrDie(config),
+		controlPlaneServer: karmadaConfig.Host,
+		auditLog:           auditLog,
 	}
-	logrus.Infof("在 karmada Host 平面创建secret")
-	_, err = util.CreateSecret(clusterKubeClient, karmadaHostPlaneSecret)
-	if err != nil {
-		return err
+	if tokenRequest {
+		if err = validateTokenExpiration(tokenExpiration); err != nil {
+			return err
+		}
+		// the kubeconfig takes the CA from the kubeconfig of karmada, as there is no token secret to take it from.
+		if err = rest.LoadTLSFiles(karmadaConfig); err != nil {
+			return err
+		}
+		requester := &tokenRequester{
+			syncer:     syncer,
+			caData:     karmadaConfig.CAData,
+			expiration: tokenExpiration,
+			audiences:  parseAudiences(tokenAudiences),
+			clock:      clock.RealClock{},
+		}
+		requester.Run(ctx, instances)
+		return nil
+	}
+	if watch {
+		return newTokenSyncController(syncer, instances, resyncPeriod).Run(ctx)
+	}
+	var failed []string
+	for _, instance := range instances {
+		if err = syncer.sync(ctx, instance); err != nil {
+			logrus.Errorf("failed to sync instance %s, error: %v", instance, err)
+			failed = append(failed, instance.String())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to sync instances %s", strings.Join(failed, ", "))
 	}
-	logrus.Infof("secret: %v 创建成功", karmadaSecretName)
 	return nil
 }
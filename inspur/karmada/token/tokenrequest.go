@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// minTokenExpiration is the shortest expiration accepted by the TokenRequest API.
+	minTokenExpiration = 10 * time.Minute
+	// tokenRefreshRatio is the part of the lifetime of a token after which it's refreshed.
+	tokenRefreshRatio = 0.8
+)
+
+// tokenRequestBackoff is the backoff of retrying a failed token request, it grows to 5 minutes.
+var tokenRequestBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      5 * time.Minute,
+}
+
+// tokenRequester requests short-lived tokens of the ServiceAccounts of the dashboards with the TokenRequest
+// API, writes them to the host secrets, and refreshes them before they expire.
+type tokenRequester struct {
+	syncer *tokenSyncer
+	// caData is the CA of karmada apiserver written to the kubeconfig, the token secrets that would hold it
+	// are not used.
+	caData     []byte
+	expiration time.Duration
+	audiences  []string
+	clock      clock.Clock
+}
+
+// validateTokenExpiration checks the value of --token-expiration.
+func validateTokenExpiration(expiration time.Duration) error {
+	if expiration < minTokenExpiration {
+		return fmt.Errorf("invalid token expiration %v, should be at least %v", expiration, minTokenExpiration)
+	}
+	return nil
+}
+
+// parseAudiences splits the comma separated audiences, empty means the audience of karmada apiserver.
+func parseAudiences(value string) []string {
+	var audiences []string
+	for _, audience := range strings.Split(value, ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			audiences = append(audiences, audience)
+		}
+	}
+	return audiences
+}
+
+// Run keeps the tokens of all the instances fresh until ctx is done.
+func (r *tokenRequester) Run(ctx context.Context, instances []dashboardInstance) {
+	var wg sync.WaitGroup
+	for _, instance := range instances {
+		wg.Add(1)
+		go func(instance dashboardInstance) {
+			defer wg.Done()
+			r.keepRefreshing(ctx, instance)
+		}(instance)
+	}
+	wg.Wait()
+}
+
+// keepRefreshing requests a token for the instance when 80% of the lifetime of the last one has passed,
+// failed requests are retried with backoff.
+func (r *tokenRequester) keepRefreshing(ctx context.Context, instance dashboardInstance) {
+	backoff := tokenRequestBackoff
+	for {
+		var next time.Duration
+		expiresAt, err := r.refresh(ctx, instance)
+		if err != nil {
+			next = backoff.Step()
+			logrus.Errorf("failed to refresh the token of instance %s, retry in %v. error: %v", instance, next, err)
+		} else {
+			backoff = tokenRequestBackoff
+			next = time.Duration(float64(expiresAt.Sub(r.clock.Now())) * tokenRefreshRatio)
+			logrus.Infof("token of instance %s expires at %s, refresh in %v", instance, expiresAt.Format(time.RFC3339), next.Round(time.Second))
+		}
+
+		timer := r.clock.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+}
+
+// refresh requests a new token of the ServiceAccount and writes it to the host secret. It returns when the
+// token expires, which may be earlier than requested if the apiserver caps the expiration.
+func (r *tokenRequester) refresh(ctx context.Context, instance dashboardInstance) (time.Time, error) {
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         r.audiences,
+			ExpirationSeconds: pointer.Int64(int64(r.expiration.Seconds())),
+		},
+	}
+	tokenRequest, err := r.syncer.controlPlaneClient.CoreV1().ServiceAccounts(instance.Namespace).
+		CreateToken(ctx, instance.ServiceAccount, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		err = fmt.Errorf("failed to request a token of service account %s/%s, error: %v", instance.Namespace, instance.ServiceAccount, err)
+		r.syncer.recordFailure(ctx, instance, reasonTokenRequestFailed, err)
+		return time.Time{}, err
+	}
+
+	data, err := r.syncer.hostSecretData([]byte(tokenRequest.Status.Token), r.caData)
+	if err != nil {
+		err = fmt.Errorf("failed to build kubeconfig with the requested token, error: %v", err)
+		r.syncer.recordFailure(ctx, instance, reasonKubeconfigInvalid, err)
+		return time.Time{}, err
+	}
+	if err = r.syncer.writeHostSecret(ctx, instance, data); err != nil {
+		return time.Time{}, err
+	}
+	return tokenRequest.Status.ExpirationTimestamp.Time, nil
+}
@@ -0,0 +1,241 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1ac "k8s.io/client-go/applyconfigurations/meta/v1"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
+	"k8s.io/client-go/dynamic"
+	kubeclient "k8s.io/client-go/kubernetes"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+// FieldManager is the field manager of the objects applied by join.
+const FieldManager = "k8s-study-joiner"
+
+// ApplyOptions are the options of applying an object in server side.
+type ApplyOptions struct {
+	// Force takes over the conflicting fields owned by other field managers instead of failing the apply.
+	Force bool
+	// DryRun sends the apply in server side dry-run mode, so that admission and validation run for real
+	// without persisting anything. The result tells what the apply would do.
+	DryRun bool
+	// ReportResult reads the object before applying it, so that the result tells whether it was created, updated
+	// or unchanged. It costs a GET per object, the result is OperationResultApplied without it.
+	ReportResult bool
+}
+
+func (o ApplyOptions) toApplyOptions() metav1.ApplyOptions {
+	applyOptions := metav1.ApplyOptions{FieldManager: FieldManager, Force: o.Force}
+	if o.DryRun {
+		applyOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	return applyOptions
+}
+
+// ApplyConflictError explains the conflict of server side apply, which means the fields of the object
+// are owned by another field manager.
+func ApplyConflictError(object string, err error) error {
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("failed to apply %s, the fields are managed by others: %w. Use --force-conflicts to take them over", object, err)
+	}
+	return fmt.Errorf("failed to apply %s, error: %w", object, err)
+}
+
+// applyResult tells what an apply did from the object before and after it. The resource version and the
+// managed fields are ignored, so that a no-op apply is reported as unchanged.
+func applyResult(getErr error, live, applied runtime.Object) (OperationResult, error) {
+	if apierrors.IsNotFound(getErr) {
+		return OperationResultCreated, nil
+	}
+	live, applied = live.DeepCopyObject(), applied.DeepCopyObject()
+	for _, obj := range []runtime.Object{live, applied} {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return "", err
+		}
+		accessor.SetResourceVersion("")
+		accessor.SetManagedFields(nil)
+	}
+	if equality.Semantic.DeepEqual(live, applied) {
+		return OperationResultUnchanged, nil
+	}
+	return OperationResultUpdated, nil
+}
+
+// applyWithResult applies the object with apply. If the result is reported, the object is read with get before
+// the apply and compared with the applied one.
+func applyWithResult(opts ApplyOptions, get, apply func() (runtime.Object, error)) (runtime.Object, OperationResult, error) {
+	if !opts.ReportResult {
+		applied, err := apply()
+		if err != nil {
+			return nil, "", err
+		}
+		return applied, OperationResultApplied, nil
+	}
+
+	live, getErr := get()
+	if getErr != nil && !apierrors.IsNotFound(getErr) {
+		return nil, "", getErr
+	}
+	applied, err := apply()
+	if err != nil {
+		return nil, "", err
+	}
+	result, err := applyResult(getErr, live, applied)
+	if err != nil {
+		return nil, "", err
+	}
+	return applied, result, nil
+}
+
+// ApplyNamespace applies the namespace in server side, and reports whether it was created, updated or unchanged.
+func ApplyNamespace(ctx context.Context, client kubeclient.Interface, namespace string, opts ApplyOptions) (*corev1.Namespace, OperationResult, error) {
+	obj, result, err := applyWithResult(opts,
+		func() (runtime.Object, error) {
+			return client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.CoreV1().Namespaces().Apply(ctx, corev1ac.Namespace(namespace), opts.toApplyOptions())
+		})
+	applied, _ := obj.(*corev1.Namespace)
+	return applied, result, err
+}
+
+// ApplyServiceAccount applies the ServiceAccount in server side, and reports whether it was created, updated or unchanged.
+func ApplyServiceAccount(ctx context.Context, client kubeclient.Interface, saObj *corev1.ServiceAccount, opts ApplyOptions) (*corev1.ServiceAccount, OperationResult, error) {
+	obj, result, err := applyWithResult(opts,
+		func() (runtime.Object, error) {
+			return client.CoreV1().ServiceAccounts(saObj.Namespace).Get(ctx, saObj.Name, metav1.GetOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.CoreV1().ServiceAccounts(saObj.Namespace).Apply(ctx, corev1ac.ServiceAccount(saObj.Name, saObj.Namespace), opts.toApplyOptions())
+		})
+	applied, _ := obj.(*corev1.ServiceAccount)
+	return applied, result, err
+}
+
+// ApplyClusterRole applies the rules of ClusterRole in server side, and reports whether it was created, updated or unchanged.
+func ApplyClusterRole(ctx context.Context, client kubeclient.Interface, clusterRole *rbacv1.ClusterRole, opts ApplyOptions) (*rbacv1.ClusterRole, OperationResult, error) {
+	applyConfig := rbacv1ac.ClusterRole(clusterRole.Name)
+	for _, rule := range clusterRole.Rules {
+		applyConfig.WithRules(rbacv1ac.PolicyRule().
+			WithVerbs(rule.Verbs...).
+			WithAPIGroups(rule.APIGroups...).
+			WithResources(rule.Resources...).
+			WithResourceNames(rule.ResourceNames...).
+			WithNonResourceURLs(rule.NonResourceURLs...))
+	}
+	obj, result, err := applyWithResult(opts,
+		func() (runtime.Object, error) {
+			return client.RbacV1().ClusterRoles().Get(ctx, clusterRole.Name, metav1.GetOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.RbacV1().ClusterRoles().Apply(ctx, applyConfig, opts.toApplyOptions())
+		})
+	applied, _ := obj.(*rbacv1.ClusterRole)
+	return applied, result, err
+}
+
+// ApplyClusterRoleBinding applies the subjects and role reference of ClusterRoleBinding in server side, and reports
+// whether it was created, updated or unchanged.
+func ApplyClusterRoleBinding(ctx context.Context, client kubeclient.Interface, clusterRoleBinding *rbacv1.ClusterRoleBinding, opts ApplyOptions) (*rbacv1.ClusterRoleBinding, OperationResult, error) {
+	applyConfig := rbacv1ac.ClusterRoleBinding(clusterRoleBinding.Name).
+		WithRoleRef(rbacv1ac.RoleRef().
+			WithAPIGroup(clusterRoleBinding.RoleRef.APIGroup).
+			WithKind(clusterRoleBinding.RoleRef.Kind).
+			WithName(clusterRoleBinding.RoleRef.Name))
+	for _, subject := range clusterRoleBinding.Subjects {
+		applyConfig.WithSubjects(rbacv1ac.Subject().
+			WithKind(subject.Kind).
+			WithAPIGroup(subject.APIGroup).
+			WithName(subject.Name).
+			WithNamespace(subject.Namespace))
+	}
+	obj, result, err := applyWithResult(opts,
+		func() (runtime.Object, error) {
+			return client.RbacV1().ClusterRoleBindings().Get(ctx, clusterRoleBinding.Name, metav1.GetOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.RbacV1().ClusterRoleBindings().Apply(ctx, applyConfig, opts.toApplyOptions())
+		})
+	applied, _ := obj.(*rbacv1.ClusterRoleBinding)
+	return applied, result, err
+}
+
+// ApplySecret applies the data, annotations and owner references of the secret in server side, and reports
+// whether it was created, updated or unchanged.
+func ApplySecret(ctx context.Context, client kubeclient.Interface, secret *corev1.Secret, opts ApplyOptions) (*corev1.Secret, OperationResult, error) {
+	applyConfig := corev1ac.Secret(secret.Name, secret.Namespace).WithData(secret.Data)
+	if secret.Type != "" {
+		applyConfig.WithType(secret.Type)
+	}
+	if len(secret.Annotations) > 0 {
+		applyConfig.WithAnnotations(secret.Annotations)
+	}
+	for _, ref := range secret.OwnerReferences {
+		ownerRef := metav1ac.OwnerReference().
+			WithAPIVersion(ref.APIVersion).
+			WithKind(ref.Kind).
+			WithName(ref.Name).
+			WithUID(ref.UID)
+		if ref.Controller != nil {
+			ownerRef.WithController(*ref.Controller)
+		}
+		if ref.BlockOwnerDeletion != nil {
+			ownerRef.WithBlockOwnerDeletion(*ref.BlockOwnerDeletion)
+		}
+		applyConfig.WithOwnerReferences(ownerRef)
+	}
+	obj, result, err := applyWithResult(opts,
+		func() (runtime.Object, error) {
+			return client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.CoreV1().Secrets(secret.Namespace).Apply(ctx, applyConfig, opts.toApplyOptions())
+		})
+	applied, _ := obj.(*corev1.Secret)
+	return applied, result, err
+}
+
+// ApplyClusterObject applies the cluster object in karmada control plane in server side, and reports whether it
+// was created, updated or unchanged. Only the fields set in clusterObj are owned by join, so that the taints and
+// labels set by others are kept.
+func ApplyClusterObject(ctx context.Context, controlPlaneClient *dynamic.DynamicClient, clusterObj *clusterv1alpha1.Cluster, opts ApplyOptions) (*clusterv1alpha1.Cluster, OperationResult, error) {
+	applyObj := *clusterObj
+	applyObj.APIVersion = clusterGVR.GroupVersion().String()
+	applyObj.Kind = "Cluster"
+	clusterMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&applyObj)
+	if err != nil {
+		return nil, "", err
+	}
+	// status is not managed by join.
+	delete(clusterMap, "status")
+
+	obj, result, err := applyWithResult(opts,
+		func() (runtime.Object, error) {
+			return controlPlaneClient.Resource(clusterGVR).Get(ctx, clusterObj.Name, metav1.GetOptions{})
+		},
+		func() (runtime.Object, error) {
+			return controlPlaneClient.Resource(clusterGVR).Apply(ctx, clusterObj.Name, &unstructured.Unstructured{Object: clusterMap}, opts.toApplyOptions())
+		})
+	if err != nil {
+		return nil, "", err
+	}
+	appliedCluster := &clusterv1alpha1.Cluster{}
+	if err = runtime.DefaultUnstructuredConverter.
+		FromUnstructured(obj.(*unstructured.Unstructured).UnstructuredContent(), appliedCluster); err != nil {
+		return nil, "", err
+	}
+	return appliedCluster, result, nil
+}
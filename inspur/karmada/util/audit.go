@@ -0,0 +1,315 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAuditLogPath is the default path of the audit log.
+const DefaultAuditLogPath = "k8s-study-audit.log"
+
+// The outcomes of audited operations.
+const (
+	AuditOutcomeSucceeded = "Succeeded"
+	AuditOutcomeFailed    = "Failed"
+)
+
+// redactedValue replaces the secret part of the values written to the audit log.
+const redactedValue = "<redacted>"
+
+// AuditRecord is a line of the audit log, which records a state changing operation. Unjoin is not audited,
+// as this tool has no unjoin command yet.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Actor     string    `json:"actor"`
+	// SourceIP is the client address of the operations requested by HTTP.
+	SourceIP string `json:"sourceIP,omitempty"`
+	Cluster  string `json:"cluster,omitempty"`
+	// Objects are the objects touched by the operation, in the form of kind/namespace/name.
+	Objects []string          `json:"objects,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	Outcome string            `json:"outcome"`
+	Error   string            `json:"error,omitempty"`
+	// PrevHash is the hash of the previous record, and Hash is the hash of this record with PrevHash.
+	// Changing or removing any record breaks the chain.
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// Finish sets the outcome of the record by err.
+func (r *AuditRecord) Finish(err error) {
+	r.Outcome = AuditOutcomeSucceeded
+	if err != nil {
+		r.Outcome = AuditOutcomeFailed
+		r.Error = err.Error()
+	}
+}
+
+// computeHash returns the hash of the record with its Hash field left empty.
+func (r AuditRecord) computeHash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditLog appends records to an append-only JSON-lines file, each record is chained to the previous one
+// by its hash. The file is locked while a record is chained and appended, as other processes may write
+// the same file.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+
+	// file, offset and lastHash remember the end of the log after the last append, so that only the records
+	// appended by other processes since then are read on the next append.
+	file     os.FileInfo
+	offset   int64
+	lastHash string
+}
+
+// NewAuditLog returns the audit log written to path.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{path: path}
+}
+
+// Append chains the record to the last one in the log and appends it.
+func (l *AuditLog) Append(record *AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s, error: %v", l.path, err)
+	}
+	defer file.Close()
+	if err = lockFile(file); err != nil {
+		return fmt.Errorf("failed to lock audit log %s, error: %v", l.path, err)
+	}
+	defer unlockFile(file)
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// the log is read from the start if it's replaced or truncated since the last append.
+	if l.file == nil || !os.SameFile(l.file, info) || info.Size() < l.offset {
+		l.offset, l.lastHash = 0, ""
+	}
+	if info.Size() > l.offset {
+		if _, err = file.Seek(l.offset, io.SeekStart); err != nil {
+			return err
+		}
+		last, err := lastAuditRecord(file)
+		if err != nil {
+			return fmt.Errorf("failed to read the last record of audit log %s, error: %v", l.path, err)
+		}
+		if last != nil {
+			l.lastHash = last.Hash
+		}
+	}
+	record.PrevHash = l.lastHash
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	if record.Hash, err = record.computeHash(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		l.file = nil
+		return fmt.Errorf("failed to append to audit log %s, error: %v", l.path, err)
+	}
+	if err = file.Sync(); err != nil {
+		l.file = nil
+		return err
+	}
+	l.file, l.offset, l.lastHash = info, info.Size()+int64(len(line))+1, record.Hash
+	return nil
+}
+
+// lastAuditRecord returns the last record in file from its current offset, or nil if there is none.
+func lastAuditRecord(file *os.File) (*AuditRecord, error) {
+	var lastLine []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lastLine = append(lastLine[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lastLine == nil {
+		return nil, nil
+	}
+
+	record := &AuditRecord{}
+	if err := json.Unmarshal(lastLine, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log and returns the number of records verified.
+// The error tells the first line where the chain is broken.
+func VerifyAuditLog(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var (
+		count    int
+		prevHash string
+	)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		record := AuditRecord{}
+		if err = json.Unmarshal(line, &record); err != nil {
+			return count, fmt.Errorf("line %d is not a valid record, error: %v", lineNumber, err)
+		}
+		if record.PrevHash != prevHash {
+			return count, fmt.Errorf("line %d does not follow the previous record, a record is changed, inserted or removed before it", lineNumber)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return count, err
+		}
+		if hash != record.Hash {
+			return count, fmt.Errorf("line %d is changed, its hash does not match", lineNumber)
+		}
+		prevHash = record.Hash
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// AuditActor returns the local user running the command, as user@host.
+func AuditActor() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s", name, host)
+}
+
+// AuditRequestSource tells who requests an operation by HTTP. The X-Remote-User and X-Forwarded-For headers
+// can be set by any client, so they are only trusted when the request comes from one of TrustedProxies.
+type AuditRequestSource struct {
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies parses the comma separated IPs or CIDRs of the trusted proxies.
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q, should be an IP or a CIDR", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, should be an IP or a CIDR", proxy)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// Identify returns the actor and the client address of the request. The actor is anonymous unless a trusted
+// proxy sets X-Remote-User. Behind trusted proxies, the client address is the last one in X-Forwarded-For
+// that is not a trusted proxy, as the ones before it could be forged by the client.
+func (s AuditRequestSource) Identify(r *http.Request) (actor, sourceIP string) {
+	actor, sourceIP = "anonymous", r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		sourceIP = host
+	}
+	if !s.isTrusted(sourceIP) {
+		return actor, sourceIP
+	}
+
+	if user := r.Header.Get("X-Remote-User"); user != "" {
+		actor = user
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		sourceIP = address
+		if !s.isTrusted(address) {
+			break
+		}
+	}
+	return actor, sourceIP
+}
+
+func (s AuditRequestSource) isTrusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range s.TrustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactToken hides the secret of a token. The ID of a bootstrap token in the form of id.secret is kept,
+// so that the token can still be told apart.
+func RedactToken(token string) string {
+	if index := strings.Index(token, "."); index > 0 && !strings.Contains(token[index+1:], ".") {
+		return token[:index] + "." + redactedValue
+	}
+	return redactedValue
+}
+
+// AuditObject returns the reference of an object written in AuditRecord.Objects.
+func AuditObject(kind, namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
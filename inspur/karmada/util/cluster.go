@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -21,11 +28,20 @@ const (
 	KubeCredentials = "KubeCredentials"
 	// KubeImpersonator is the secret that contains the token of impersonator whether reported when registering cluster
 	KubeImpersonator = "KubeImpersonator"
+	// None means neither of the secrets is reported when registering cluster
+	None = "None"
+
+	// SecretTokenKey is the name of secret token key.
+	SecretTokenKey = "token"
+	// SecretCADataKey is the name of secret caBundle key.
+	SecretCADataKey = "caBundle"
 )
 
+var clusterGVR = schema.GroupVersionResource{Group: "cluster.karmada.io", Version: "v1alpha1", Resource: "clusters"}
+
 // ObtainClusterID returns the cluster ID property with clusterKubeClient
-func ObtainClusterID(clusterKubeClient kubernetes.Interface) (string, error) {
-	ns, err := clusterKubeClient.CoreV1().Namespaces().Get(context.TODO(), metav1.NamespaceSystem, metav1.GetOptions{})
+func ObtainClusterID(ctx context.Context, clusterKubeClient kubernetes.Interface) (string, error) {
+	ns, err := clusterKubeClient.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -39,43 +55,133 @@ type ClusterRegisterOption struct {
 	ReportSecrets      []string
 	ClusterAPIEndpoint string
 	ProxyServerAddress string
+	ProxyHeader        map[string]string
 	ClusterProvider    string
 	ClusterRegion      string
 	ClusterZone        string
-	DryRun             bool
+	// InsecureSkipTLSVerification allows control plane to skip verifying the serving certificate of member cluster.
+	InsecureSkipTLSVerification bool
+
+	// Labels and Annotations are set on the Cluster object when it's created.
+	Labels      map[string]string
+	Annotations map[string]string
+	// LabelsFromNodeTopology derives the region and zone labels of the Cluster object from the
+	// topology labels of member cluster nodes. The labels in Labels take precedence.
+	LabelsFromNodeTopology bool
+	// ForceConflicts takes over the fields owned by other field managers when the objects of join are applied.
+	ForceConflicts bool
+	// ReportChanges reads every object of join before applying it, so that join tells whether it was created,
+	// updated or unchanged.
+	ReportChanges bool
+	// ServiceAccountSecretTimeout is the time to wait for the token secrets of the ServiceAccounts in member cluster.
+	ServiceAccountSecretTimeout time.Duration
+	// JoinLeaseDuration is how long the lease locking the member cluster during join is valid without being renewed.
+	JoinLeaseDuration time.Duration
 
 	ControlPlaneConfig *rest.Config
 	ClusterConfig      *rest.Config
 	Secret             corev1.Secret
 	ImpersonatorSecret corev1.Secret
+	CABundle           []byte
 	ClusterID          string
 }
 
-// CreateClusterObject create cluster object in karmada control plane
-func CreateClusterObject(controlPlaneClient *dynamic.DynamicClient, clusterObj *clusterv1alpha1.Cluster) (*clusterv1alpha1.Cluster, error) {
-	// 检查集群名字是否存在
-	cluster, exist, err := GetClusterWithKarmadaClient(controlPlaneClient, clusterObj.Name)
-	if err != nil {
-		return nil, err
+// Validate checks the labels and annotations of the option are valid Kubernetes syntax.
+func (r *ClusterRegisterOption) Validate() error {
+	errs := metav1validation.ValidateLabels(r.Labels, field.NewPath("labels"))
+	errs = append(errs, apivalidation.ValidateAnnotations(r.Annotations, field.NewPath("annotations"))...)
+
+	for i, secret := range r.ReportSecrets {
+		switch secret {
+		case KubeCredentials, KubeImpersonator:
+		case None:
+			if len(r.ReportSecrets) > 1 {
+				errs = append(errs, field.Invalid(field.NewPath("reportSecrets").Index(i), secret, "None can not be combined with other secrets"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(field.NewPath("reportSecrets").Index(i), secret, []string{KubeCredentials, KubeImpersonator, None}))
+		}
 	}
 
-	if exist {
-		return cluster, fmt.Errorf("cluster(%s) already exist", clusterObj.Name)
+	if r.ClusterAPIEndpoint != "" {
+		if _, err := url.ParseRequestURI(r.ClusterAPIEndpoint); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("clusterAPIEndpoint"), r.ClusterAPIEndpoint, err.Error()))
+		}
 	}
+	if r.ProxyServerAddress != "" {
+		if _, err := ParseProxyURL(r.ProxyServerAddress); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("proxyServerAddress"), r.ProxyServerAddress, err.Error()))
+		}
+	}
+	// the lease records its duration in whole seconds, a shorter one would be recorded as zero.
+	if r.JoinLeaseDuration < 0 || (r.JoinLeaseDuration > 0 && r.JoinLeaseDuration < time.Second) {
+		errs = append(errs, field.Invalid(field.NewPath("joinLeaseDuration"), r.JoinLeaseDuration.String(), "must be at least 1s"))
+	}
+	for key := range r.ProxyHeader {
+		if strings.TrimSpace(key) == "" || strings.ContainsAny(key, " \t:") {
+			errs = append(errs, field.Invalid(field.NewPath("proxyHeader"), key, "not a valid HTTP header key"))
+		}
+	}
+	return errs.ToAggregate()
+}
+
+// ApplyOptions returns the options of applying the objects of join.
+func (r *ClusterRegisterOption) ApplyOptions() ApplyOptions {
+	return ApplyOptions{Force: r.ForceConflicts, ReportResult: r.ReportChanges}
+}
 
-	if cluster, err = createCluster(controlPlaneClient, clusterObj); err != nil {
-		logrus.Errorf("Failed to create cluster(%s). error: %v", clusterObj.Name, err)
+// IsKubeCredentialsEnabled tells if the credentials secret should be reported.
+func (r *ClusterRegisterOption) IsKubeCredentialsEnabled() bool {
+	return r.isSecretReported(KubeCredentials)
+}
+
+// IsKubeImpersonatorEnabled tells if the impersonator secret should be reported.
+func (r *ClusterRegisterOption) IsKubeImpersonatorEnabled() bool {
+	return r.isSecretReported(KubeImpersonator)
+}
+
+func (r *ClusterRegisterOption) isSecretReported(secret string) bool {
+	for _, reported := range r.ReportSecrets {
+		if reported == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// topologyLabelKeys are the node labels that the cluster labels can be derived from.
+var topologyLabelKeys = []string{corev1.LabelTopologyRegion, corev1.LabelTopologyZone}
+
+// ObtainClusterTopologyLabels derives the cluster labels from the topology labels of the member cluster nodes.
+// A label is derived only if all the nodes carrying it share the same value.
+func ObtainClusterTopologyLabels(ctx context.Context, clusterKubeClient kubernetes.Interface) (map[string]string, error) {
+	nodeList, err := clusterKubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
 		return nil, err
 	}
 
-	return cluster, nil
+	labels := map[string]string{}
+	for _, key := range topologyLabelKeys {
+		values := sets.NewString()
+		for _, node := range nodeList.Items {
+			if value, ok := node.Labels[key]; ok {
+				values.Insert(value)
+			}
+		}
+		switch values.Len() {
+		case 0:
+		case 1:
+			labels[key] = values.List()[0]
+		default:
+			logrus.Warnf("skip deriving label %s as nodes are labeled with multiple values: %v", key, values.List())
+		}
+	}
+	return labels, nil
 }
 
 // GetClusterWithKarmadaClient tells if a cluster already joined to control plane.
-func GetClusterWithKarmadaClient(client *dynamic.DynamicClient, name string) (*clusterv1alpha1.Cluster, bool, error) {
-	gvr := schema.GroupVersionResource{"cluster.karmada.io", "v1alpha1", "clusters"}
-
-	unstructObj, err := client.Resource(gvr).Get(context.TODO(), name, metav1.GetOptions{})
+func GetClusterWithKarmadaClient(ctx context.Context, client *dynamic.DynamicClient, name string) (*clusterv1alpha1.Cluster, bool, error) {
+	unstructObj, err := client.Resource(clusterGVR).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			return nil, false, nil
@@ -96,51 +202,73 @@ func GetClusterWithKarmadaClient(client *dynamic.DynamicClient, name string) (*c
 	return cluster, true, nil
 }
 
-func createCluster(controlPlaneClient *dynamic.DynamicClient, cluster *clusterv1alpha1.Cluster) (*clusterv1alpha1.Cluster, error) {
-	gvr := schema.GroupVersionResource{"cluster.karmada.io", "v1alpha1", "clusters"}
-
-	clusterMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&cluster)
+// ListClusters lists all the clusters registered in karmada control plane.
+func ListClusters(ctx context.Context, client *dynamic.DynamicClient) ([]clusterv1alpha1.Cluster, error) {
+	unstructObj, err := client.Resource(clusterGVR).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	newClusterUnstruct, err := controlPlaneClient.Resource(gvr).Create(context.TODO(), &unstructured.Unstructured{clusterMap}, metav1.CreateOptions{})
-	if err != nil {
-		logrus.Errorf("Failed to create cluster(%s). error: %v", cluster.Name, err)
-		return nil, err
-	}
-	newCluster := &clusterv1alpha1.Cluster{}
-	// 转换
+	clusterList := &clusterv1alpha1.ClusterList{}
 
-	if err = runtime.DefaultUnstructuredConverter.
-		FromUnstructured(newClusterUnstruct.UnstructuredContent(), newCluster); err != nil {
+	// 转换
+	err = runtime.DefaultUnstructuredConverter.
+		FromUnstructured(unstructObj.UnstructuredContent(), clusterList)
+	if err != nil {
 		return nil, err
 	}
-	return newCluster, nil
+	return clusterList.Items, nil
 }
 
 // IsClusterIdentifyUnique checks whether the ClusterID exists in the karmada control plane.
-func IsClusterIdentifyUnique(dynamiccontrolPlaneClient *dynamic.DynamicClient, id string) (bool, string, error) {
-	gvr := schema.GroupVersionResource{"cluster.karmada.io", "v1alpha1", "clusters"}
-
-	unstructObj, err := dynamiccontrolPlaneClient.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return false, "", err
-	}
-
-	clusterList := &clusterv1alpha1.ClusterList{}
-
-	// 转换
-	err = runtime.DefaultUnstructuredConverter.
-		FromUnstructured(unstructObj.UnstructuredContent(), clusterList)
+func IsClusterIdentifyUnique(ctx context.Context, dynamiccontrolPlaneClient *dynamic.DynamicClient, id string) (bool, string, error) {
+	clusters, err := ListClusters(ctx, dynamiccontrolPlaneClient)
 	if err != nil {
 		return false, "", err
 	}
 
-	for _, cluster := range clusterList.Items {
+	for _, cluster := range clusters {
 		if cluster.Spec.ID == id {
 			return false, cluster.Name, nil
 		}
 	}
 	return true, "", nil
 }
+
+// BuildClusterConfig builds the rest config to access the member cluster the same way as karmada
+// control plane does, with the endpoint and proxy of the cluster and the credentials held by secret.
+func BuildClusterConfig(cluster *clusterv1alpha1.Cluster, secret *corev1.Secret) (*rest.Config, error) {
+	if cluster.Spec.APIEndpoint == "" {
+		return nil, fmt.Errorf("the api endpoint of cluster %s is empty", cluster.Name)
+	}
+
+	token, ok := secret.Data[SecretTokenKey]
+	if !ok || len(token) == 0 {
+		return nil, fmt.Errorf("the secret %s/%s for cluster %s is missing a non-empty value for %q", secret.Namespace, secret.Name, cluster.Name, SecretTokenKey)
+	}
+
+	clusterConfig := &rest.Config{
+		Host:        cluster.Spec.APIEndpoint,
+		BearerToken: string(token),
+	}
+
+	if cluster.Spec.InsecureSkipTLSVerification {
+		clusterConfig.TLSClientConfig.Insecure = true
+	} else {
+		caData, ok := secret.Data[SecretCADataKey]
+		if !ok || len(caData) == 0 {
+			return nil, fmt.Errorf("the secret %s/%s for cluster %s is missing a non-empty value for %q", secret.Namespace, secret.Name, cluster.Name, SecretCADataKey)
+		}
+		clusterConfig.TLSClientConfig.CAData = caData
+	}
+
+	if cluster.Spec.ProxyURL != "" {
+		proxy, err := url.Parse(cluster.Spec.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy url %s of cluster %s, error: %w", cluster.Spec.ProxyURL, cluster.Name, err)
+		}
+		SetProxy(clusterConfig, proxy, cluster.Spec.ProxyHeader)
+	}
+
+	return clusterConfig, nil
+}
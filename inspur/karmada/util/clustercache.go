@@ -0,0 +1,192 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+// The indexes of ClusterCache.
+const (
+	ClusterIDIndex       = "spec.id"
+	ClusterRegionIndex   = "spec.region"
+	ClusterTopologyIndex = "spec.topology"
+)
+
+// ClusterCache holds the clusters of karmada control plane watched by a shared informer, and indexes them by
+// cluster ID and topology. It's meant for the long-lived servers, which would otherwise list all the clusters
+// on every lookup.
+type ClusterCache struct {
+	informer cache.SharedIndexInformer
+}
+
+// NewClusterCache returns the cache of the clusters, it's filled once Run is called. A zero resync disables the
+// periodic resync.
+func NewClusterCache(client dynamic.Interface, resync time.Duration) *ClusterCache {
+	indexers := cache.Indexers{
+		ClusterIDIndex:       clusterIDIndexFunc,
+		ClusterRegionIndex:   clusterRegionIndexFunc,
+		ClusterTopologyIndex: clusterTopologyIndexFunc,
+	}
+	return &ClusterCache{
+		informer: dynamicinformer.NewFilteredDynamicInformer(client, clusterGVR, "", resync, indexers, nil).Informer(),
+	}
+}
+
+// Informer returns the shared informer of the cache, the handlers added to it see the unstructured clusters.
+func (c *ClusterCache) Informer() cache.SharedIndexInformer {
+	return c.informer
+}
+
+// Run runs the informer until stopCh is closed.
+func (c *ClusterCache) Run(stopCh <-chan struct{}) {
+	c.informer.Run(stopCh)
+}
+
+// HasSynced tells if all the clusters have been listed.
+func (c *ClusterCache) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// WaitForCacheSync waits for all the clusters to be listed, false is returned if ctx is done before that.
+func (c *ClusterCache) WaitForCacheSync(ctx context.Context) bool {
+	return cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced)
+}
+
+// Get returns the cluster with the name, false is returned if it does not exist.
+func (c *ClusterCache) Get(name string) (*clusterv1alpha1.Cluster, bool, error) {
+	obj, exist, err := c.informer.GetStore().GetByKey(name)
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	cluster, err := ConvertToCluster(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return cluster, true, nil
+}
+
+// List returns the clusters matching selector sorted by name.
+func (c *ClusterCache) List(selector labels.Selector) ([]clusterv1alpha1.Cluster, error) {
+	var objs []interface{}
+	err := cache.ListAll(c.informer.GetIndexer(), selector, func(obj interface{}) {
+		objs = append(objs, obj)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertToSortedClusters(objs)
+}
+
+// ByID returns the clusters registered with the cluster ID. More than one cluster means the same member
+// cluster is registered with different names.
+func (c *ClusterCache) ByID(id string) ([]clusterv1alpha1.Cluster, error) {
+	return c.byIndex(ClusterIDIndex, id)
+}
+
+// ByRegion returns the clusters in the region.
+func (c *ClusterCache) ByRegion(region string) ([]clusterv1alpha1.Cluster, error) {
+	return c.byIndex(ClusterRegionIndex, region)
+}
+
+// ByTopology returns the clusters of the provider in the region and zone.
+func (c *ClusterCache) ByTopology(provider, region, zone string) ([]clusterv1alpha1.Cluster, error) {
+	return c.byIndex(ClusterTopologyIndex, topologyIndexKey(provider, region, zone))
+}
+
+func (c *ClusterCache) byIndex(indexName, value string) ([]clusterv1alpha1.Cluster, error) {
+	objs, err := c.informer.GetIndexer().ByIndex(indexName, value)
+	if err != nil {
+		return nil, err
+	}
+	return convertToSortedClusters(objs)
+}
+
+func convertToSortedClusters(objs []interface{}) ([]clusterv1alpha1.Cluster, error) {
+	clusters := make([]clusterv1alpha1.Cluster, 0, len(objs))
+	for _, obj := range objs {
+		cluster, err := ConvertToCluster(obj)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, *cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters, nil
+}
+
+// ConvertToCluster converts an object of the cluster informer to the typed cluster, the last known state of
+// a deleted cluster is unwrapped.
+func ConvertToCluster(obj interface{}) (*clusterv1alpha1.Cluster, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	unstructObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T of cluster informer", obj)
+	}
+
+	cluster := &clusterv1alpha1.Cluster{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructObj.UnstructuredContent(), cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// The index functions read the fields from the unstructured clusters directly, so that indexing does not
+// convert the whole object. A cluster with empty fields is not indexed.
+
+func clusterIDIndexFunc(obj interface{}) ([]string, error) {
+	fields, err := clusterSpecFields(obj, "id")
+	if err != nil || fields[0] == "" {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func clusterRegionIndexFunc(obj interface{}) ([]string, error) {
+	fields, err := clusterSpecFields(obj, "region")
+	if err != nil || fields[0] == "" {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func clusterTopologyIndexFunc(obj interface{}) ([]string, error) {
+	fields, err := clusterSpecFields(obj, "provider", "region", "zone")
+	if err != nil || fields[0]+fields[1]+fields[2] == "" {
+		return nil, err
+	}
+	return []string{topologyIndexKey(fields[0], fields[1], fields[2])}, nil
+}
+
+func topologyIndexKey(provider, region, zone string) string {
+	return fmt.Sprintf("%s/%s/%s", provider, region, zone)
+}
+
+// clusterSpecFields returns the string fields of the cluster spec in order, a missing field is empty.
+func clusterSpecFields(obj interface{}, names ...string) ([]string, error) {
+	unstructObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T of cluster informer", obj)
+	}
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		field, _, err := unstructured.NestedString(unstructObj.Object, "spec", name)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,199 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+// FailureReason is the category of a failed diagnosis check.
+type FailureReason string
+
+const (
+	FailureReasonSecret  FailureReason = "Secret"
+	FailureReasonDNS     FailureReason = "DNS"
+	FailureReasonTLS     FailureReason = "TLS"
+	FailureReasonAuth    FailureReason = "Auth"
+	FailureReasonRBAC    FailureReason = "RBAC"
+	FailureReasonProxy   FailureReason = "Proxy"
+	FailureReasonTimeout FailureReason = "Timeout"
+	FailureReasonUnknown FailureReason = "Unknown"
+)
+
+// remediationHints tells how to fix each category of failure.
+var remediationHints = map[FailureReason]string{
+	FailureReasonSecret:  "re-join the cluster or rotate its credentials to regenerate the secrets",
+	FailureReasonDNS:     "check that the apiEndpoint host can be resolved from karmada control plane",
+	FailureReasonTLS:     "check that caBundle signs the serving certificate and the certificate SANs cover the apiEndpoint",
+	FailureReasonAuth:    "the token is invalid or revoked, rotate the credentials of the cluster",
+	FailureReasonRBAC:    "check the ClusterRole and ClusterRoleBinding of the karmada ServiceAccount in member cluster",
+	FailureReasonProxy:   "check that the proxyURL is reachable and the proxyHeader is accepted by the proxy",
+	FailureReasonTimeout: "check the network between karmada control plane and the member cluster",
+	FailureReasonUnknown: "check the message for details",
+}
+
+// DiagnosisCheck is the result of one diagnosis check of a cluster.
+type DiagnosisCheck struct {
+	Name    string        `json:"name"`
+	Passed  bool          `json:"passed"`
+	Reason  FailureReason `json:"reason,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Hint    string        `json:"hint,omitempty"`
+}
+
+// ClusterDiagnosis holds all diagnosis checks of a cluster.
+type ClusterDiagnosis struct {
+	Cluster     string           `json:"cluster"`
+	APIEndpoint string           `json:"apiEndpoint"`
+	Checks      []DiagnosisCheck `json:"checks"`
+}
+
+// Healthy tells if all the checks passed.
+func (d *ClusterDiagnosis) Healthy() bool {
+	for _, check := range d.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *ClusterDiagnosis) pass(name, message string) {
+	d.Checks = append(d.Checks, DiagnosisCheck{Name: name, Passed: true, Message: message})
+}
+
+func (d *ClusterDiagnosis) fail(name string, reason FailureReason, err error) {
+	d.Checks = append(d.Checks, DiagnosisCheck{Name: name, Reason: reason, Message: err.Error(), Hint: remediationHints[reason]})
+}
+
+// DiagnoseCluster checks the secrets of a push mode cluster, then reaches the member cluster
+// with them the same way as karmada control plane does.
+func DiagnoseCluster(ctx context.Context, controlPlaneKubeClient kubeclient.Interface, cluster *clusterv1alpha1.Cluster, timeout time.Duration) *ClusterDiagnosis {
+	diagnosis, secret := diagnoseClusterSecrets(ctx, controlPlaneKubeClient, cluster)
+	if secret == nil {
+		return diagnosis
+	}
+
+	clusterConfig, err := BuildClusterConfig(cluster, secret)
+	if err != nil {
+		diagnosis.fail("RestConfig", FailureReasonSecret, err)
+		return diagnosis
+	}
+	clusterConfig.Timeout = timeout
+	clusterKubeClient, err := kubeclient.NewForConfig(clusterConfig)
+	if err != nil {
+		diagnosis.fail("RestConfig", ClassifyError(err), err)
+		return diagnosis
+	}
+
+	version, err := ServerVersion(ctx, clusterKubeClient.Discovery())
+	if err != nil {
+		diagnosis.fail("Discovery", ClassifyError(err), err)
+		return diagnosis
+	}
+	diagnosis.pass("Discovery", fmt.Sprintf("kubernetes %s", version.GitVersion))
+
+	review := &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: metav1.NamespaceDefault},
+	}
+	review, err = clusterKubeClient.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		diagnosis.fail("SelfSubjectRulesReview", ClassifyError(err), err)
+		return diagnosis
+	}
+	if len(review.Status.ResourceRules) == 0 {
+		diagnosis.fail("SelfSubjectRulesReview", FailureReasonRBAC, fmt.Errorf("no resource rule is granted, evaluation error: %q", review.Status.EvaluationError))
+		return diagnosis
+	}
+	diagnosis.pass("SelfSubjectRulesReview", fmt.Sprintf("%d resource rules granted", len(review.Status.ResourceRules)))
+	return diagnosis
+}
+
+// DiagnoseClusterSecrets only checks the secrets of a push mode cluster, without reaching the member cluster.
+func DiagnoseClusterSecrets(ctx context.Context, controlPlaneKubeClient kubeclient.Interface, cluster *clusterv1alpha1.Cluster) *ClusterDiagnosis {
+	diagnosis, _ := diagnoseClusterSecrets(ctx, controlPlaneKubeClient, cluster)
+	return diagnosis
+}
+
+// diagnoseClusterSecrets checks the secrets of the cluster, and returns the secret holding the credentials
+// if it's valid.
+func diagnoseClusterSecrets(ctx context.Context, controlPlaneKubeClient kubeclient.Interface, cluster *clusterv1alpha1.Cluster) (*ClusterDiagnosis, *corev1.Secret) {
+	diagnosis := &ClusterDiagnosis{Cluster: cluster.Name, APIEndpoint: cluster.Spec.APIEndpoint}
+
+	secret, err := checkClusterSecret(ctx, controlPlaneKubeClient, cluster.Spec.SecretRef, SecretTokenKey, SecretCADataKey)
+	if err != nil {
+		diagnosis.fail("SecretRef", FailureReasonSecret, err)
+	} else {
+		diagnosis.pass("SecretRef", fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
+	}
+	// the impersonator secret is optional, as it's only reported on request. It only holds the token.
+	if cluster.Spec.ImpersonatorSecretRef != nil {
+		impersonatorSecret, err := checkClusterSecret(ctx, controlPlaneKubeClient, cluster.Spec.ImpersonatorSecretRef, SecretTokenKey)
+		if err != nil {
+			diagnosis.fail("ImpersonatorSecretRef", FailureReasonSecret, err)
+		} else {
+			diagnosis.pass("ImpersonatorSecretRef", fmt.Sprintf("%s/%s", impersonatorSecret.Namespace, impersonatorSecret.Name))
+		}
+	}
+	return diagnosis, secret
+}
+
+// checkClusterSecret makes sure the referenced secret exists and holds non-empty values for keys.
+func checkClusterSecret(ctx context.Context, client kubeclient.Interface, ref *clusterv1alpha1.LocalSecretReference, keys ...string) (*corev1.Secret, error) {
+	if ref == nil {
+		return nil, fmt.Errorf("secret reference is not set")
+	}
+	secret, err := client.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s, error: %w", ref.Namespace, ref.Name, err)
+	}
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			return nil, fmt.Errorf("secret %s/%s is missing a non-empty value for %q", ref.Namespace, ref.Name, key)
+		}
+	}
+	return secret, nil
+}
+
+// ClassifyError tells the category of an error returned when accessing a member cluster.
+func ClassifyError(err error) FailureReason {
+	var (
+		dnsErr       *net.DNSError
+		netErr       net.Error
+		unknownCAErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		headerErr    tls.RecordHeaderError
+	)
+
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return FailureReasonAuth
+	case apierrors.IsForbidden(err):
+		return FailureReasonRBAC
+	case strings.Contains(err.Error(), "proxyconnect"):
+		// errors when connecting to the proxy are prefixed with "proxyconnect" by net/http.
+		return FailureReasonProxy
+	case errors.As(err, &dnsErr):
+		return FailureReasonDNS
+	case errors.As(err, &unknownCAErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		errors.As(err, &headerErr), strings.Contains(err.Error(), "x509:"), strings.Contains(err.Error(), "tls:"):
+		return FailureReasonTLS
+	case errors.Is(err, context.DeadlineExceeded), apierrors.IsTimeout(err), apierrors.IsServerTimeout(err),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return FailureReasonTimeout
+	}
+	return FailureReasonUnknown
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// newForbiddenTestClient returns a client which is forbidden to do verb on resource.
+func newForbiddenTestClient(verb, resource string, objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor(verb, resource, func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource(resource), "", fmt.Errorf("%s is not allowed", action.GetVerb()))
+	})
+	return client
+}
+
+func TestClassifyJoinStepError(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     func() error
+		expected FailureReason
+	}{
+		{
+			name: "apply forbidden",
+			step: func() error {
+				_, _, err := ApplyNamespace(context.TODO(), newForbiddenTestClient("patch", "namespaces"), "karmada-cluster", ApplyOptions{})
+				return ApplyConflictError("Namespace karmada-cluster", err)
+			},
+			expected: FailureReasonRBAC,
+		},
+		{
+			name: "token secret forbidden",
+			step: func() error {
+				sa := newWaiterTestServiceAccount()
+				client := newForbiddenTestClient("*", "secrets", sa)
+				_, err := WaitForServiceAccountSecretCreation(context.TODO(), client, sa, waiterTestTimeout)
+				return fmt.Errorf("failed to get serviceAccount secret from cluster(member1), error: %w", err)
+			},
+			expected: FailureReasonRBAC,
+		},
+		{
+			name: "apply unauthorized",
+			step: func() error {
+				return ApplyConflictError("Namespace karmada-cluster", apierrors.NewUnauthorized("token expired"))
+			},
+			expected: FailureReasonAuth,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.step()
+			if err == nil {
+				t.Fatal("expected the step to fail")
+			}
+			if reason := ClassifyError(err); reason != tt.expected {
+				t.Errorf("expected %q classified as %s, got %s", err, tt.expected, reason)
+			}
+		})
+	}
+}
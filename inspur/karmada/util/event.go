@@ -0,0 +1,93 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeclient "k8s.io/client-go/kubernetes"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+// The reasons of the events recorded against Cluster objects. Unjoin has no reason, as this tool has no unjoin
+// command to record it yet.
+const (
+	EventReasonClusterJoined             = "ClusterJoined"
+	EventReasonCredentialsRotated        = "CredentialsRotated"
+	EventReasonCredentialsRotationFailed = "CredentialsRotationFailed"
+	EventReasonClusterHealthy            = "ClusterHealthy"
+	EventReasonClusterUnhealthy          = "ClusterUnhealthy"
+)
+
+// EventReportingComponent is the component reporting the events of Cluster objects.
+const EventReportingComponent = "k8s-study-joiner"
+
+// maxEventMessageLength is the limit of event message, the longer part is truncated.
+const maxEventMessageLength = 1024
+
+// RecordClusterEvent records an event against the cluster object in karmada control plane, so that it's shown
+// by `kubectl describe cluster`. Events of cluster scoped objects are stored in the default namespace.
+func RecordClusterEvent(ctx context.Context, client kubeclient.Interface, cluster *clusterv1alpha1.Cluster, eventType, reason, message string) error {
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+	instance, _ := os.Hostname()
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: cluster.Name + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      clusterGVR.GroupVersion().String(),
+			Kind:            "Cluster",
+			Name:            cluster.Name,
+			UID:             cluster.UID,
+			ResourceVersion: cluster.ResourceVersion,
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: EventReportingComponent, Host: instance},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: EventReportingComponent,
+		ReportingInstance:   instance,
+	}
+	_, err := client.CoreV1().Events(metav1.NamespaceDefault).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to record %s event of cluster(%s), error: %v", reason, cluster.Name, err)
+	}
+	return nil
+}
+
+// LatestClusterEventReason returns the reason of the latest event of the cluster among reasons,
+// or empty if no such event is recorded.
+func LatestClusterEventReason(ctx context.Context, client kubeclient.Interface, clusterName string, reasons ...string) (string, error) {
+	eventList, err := client.CoreV1().Events(metav1.NamespaceDefault).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=Cluster,involvedObject.name=%s", clusterName),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	reasonSet := sets.NewString(reasons...)
+	var latest *corev1.Event
+	for i := range eventList.Items {
+		event := &eventList.Items[i]
+		if !reasonSet.Has(event.Reason) {
+			continue
+		}
+		if latest == nil || latest.LastTimestamp.Before(&event.LastTimestamp) {
+			latest = event
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+	return latest.Reason, nil
+}
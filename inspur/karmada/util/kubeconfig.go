@@ -0,0 +1,35 @@
+package util
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// SecretKubeconfigKey is the key of the kubeconfig in the secrets generated for the clients of a cluster.
+const SecretKubeconfigKey = "kubeconfig"
+
+// BuildTokenKubeconfig renders a kubeconfig reaching server with the token, the server certificate is verified
+// with caData. The cluster, user and context are all named after name.
+func BuildTokenKubeconfig(name, server string, caData, token []byte) ([]byte, error) {
+	if server == "" {
+		return nil, fmt.Errorf("the server of kubeconfig %s is empty", name)
+	}
+	if len(caData) == 0 {
+		return nil, fmt.Errorf("the CA data of kubeconfig %s is empty", name)
+	}
+	if len(token) == 0 {
+		return nil, fmt.Errorf("the token of kubeconfig %s is empty", name)
+	}
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: caData,
+	}
+	config.AuthInfos[name] = &clientcmdapi.AuthInfo{Token: string(token)}
+	config.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	config.CurrentContext = name
+	return clientcmd.Write(*config)
+}
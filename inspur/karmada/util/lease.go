@@ -0,0 +1,258 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/pointer"
+)
+
+// DefaultJoinLeaseDuration is how long the lease of a join is valid without being renewed.
+const DefaultJoinLeaseDuration = 30 * time.Second
+
+// JoinLeaseNamespace is the namespace of the leases of joins in control plane. It's fixed rather than the
+// namespace of the joined cluster, so that joins of the same cluster with different options still exclude each other.
+const JoinLeaseNamespace = "karmada-cluster"
+
+// joinLeaseNamePrefix is the prefix of the leases of joins, followed by the cluster ID.
+const joinLeaseNamePrefix = "join-"
+
+// leaseReleaseTimeout bounds releasing a lease, which is still done after the join is interrupted.
+const leaseReleaseTimeout = 10 * time.Second
+
+// LeaseHeldError is returned when the lease is held by another holder and has not expired.
+type LeaseHeldError struct {
+	Lease     string
+	Holder    string
+	ExpiresAt time.Time
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("lease %s is held by %s until %s, the same cluster is being joined by another process",
+		e.Lease, e.Holder, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// ClusterLease is a coordination.k8s.io Lease locking a member cluster by its cluster ID, so that only one
+// process joins it at a time. A lease not renewed within its duration is stale and taken over.
+type ClusterLease struct {
+	client         kubeclient.Interface
+	clock          clock.WithTicker
+	namespace      string
+	name           string
+	holderIdentity string
+	duration       time.Duration
+
+	// held is the lease last written by this holder.
+	held *coordinationv1.Lease
+}
+
+// NewClusterLease returns the lease of the cluster ID in JoinLeaseNamespace, the default duration is used if
+// duration is zero. The duration is rounded up to whole seconds, which the lease records.
+func NewClusterLease(client kubeclient.Interface, clusterID, holderIdentity string, duration time.Duration) *ClusterLease {
+	if duration <= 0 {
+		duration = DefaultJoinLeaseDuration
+	}
+	if remainder := duration % time.Second; remainder != 0 {
+		duration += time.Second - remainder
+	}
+	return &ClusterLease{
+		client:         client,
+		clock:          clock.RealClock{},
+		namespace:      JoinLeaseNamespace,
+		name:           joinLeaseNamePrefix + clusterID,
+		holderIdentity: holderIdentity,
+		duration:       duration,
+	}
+}
+
+// JoinLeaseHolderIdentity returns a holder identity unique to this process, led by the local user.
+func JoinLeaseHolderIdentity() string {
+	return fmt.Sprintf("%s_%s", AuditActor(), uuid.NewUUID())
+}
+
+// WithClock replaces the clock deciding the renew time and the expiry of the lease.
+func (l *ClusterLease) WithClock(c clock.WithTicker) *ClusterLease {
+	l.clock = c
+	return l
+}
+
+// Acquire creates the lease, or takes it over if it's held by this holder or has expired.
+func (l *ClusterLease) Acquire(ctx context.Context) error {
+	if _, _, err := ApplyNamespace(ctx, l.client, l.namespace, ApplyOptions{}); err != nil {
+		return err
+	}
+
+	lease, err := l.client.CoordinationV1().Leases(l.namespace).Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		created, err := l.client.CoordinationV1().Leases(l.namespace).Create(ctx, l.newLease(), metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("lease %s/%s is acquired by another process at the same time", l.namespace, l.name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create lease %s/%s, error: %w", l.namespace, l.name, err)
+		}
+		l.held = created
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get lease %s/%s, error: %w", l.namespace, l.name, err)
+	}
+
+	holder := pointer.StringDeref(lease.Spec.HolderIdentity, "")
+	if holder != "" && holder != l.holderIdentity {
+		expiresAt := leaseExpiresAt(lease)
+		if l.clock.Now().Before(expiresAt) {
+			return &LeaseHeldError{Lease: fmt.Sprintf("%s/%s", l.namespace, l.name), Holder: holder, ExpiresAt: expiresAt}
+		}
+		logrus.Warnf("taking over the stale lease %s/%s held by %s, which expired at %s", l.namespace, l.name, holder, expiresAt.Format(time.RFC3339))
+	}
+
+	now := metav1.NewMicroTime(l.clock.Now())
+	if holder != l.holderIdentity {
+		lease.Spec.AcquireTime = &now
+		lease.Spec.LeaseTransitions = pointer.Int32(pointer.Int32Deref(lease.Spec.LeaseTransitions, 0) + 1)
+	}
+	lease.Spec.HolderIdentity = pointer.String(l.holderIdentity)
+	lease.Spec.LeaseDurationSeconds = pointer.Int32(int32(l.duration.Seconds()))
+	lease.Spec.RenewTime = &now
+	// the resource version of the lease read makes the update fail if another process takes it over first.
+	updated, err := l.client.CoordinationV1().Leases(l.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("lease %s/%s is taken over by another process at the same time", l.namespace, l.name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to take over lease %s/%s, error: %w", l.namespace, l.name, err)
+	}
+	l.held = updated
+	return nil
+}
+
+// Renew extends the lease held by this holder.
+func (l *ClusterLease) Renew(ctx context.Context) error {
+	if l.held == nil {
+		return fmt.Errorf("lease %s/%s is not acquired", l.namespace, l.name)
+	}
+	lease := l.held.DeepCopy()
+	now := metav1.NewMicroTime(l.clock.Now())
+	lease.Spec.RenewTime = &now
+	updated, err := l.client.CoordinationV1().Leases(l.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	l.held = updated
+	return nil
+}
+
+// Release deletes the lease if it's still held by this holder, a lease taken over by another holder is kept.
+func (l *ClusterLease) Release(ctx context.Context) error {
+	if l.held == nil {
+		return nil
+	}
+	err := l.client.CoordinationV1().Leases(l.namespace).Delete(ctx, l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &l.held.UID, ResourceVersion: &l.held.ResourceVersion},
+	})
+	l.held = nil
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return fmt.Errorf("failed to release lease %s/%s, error: %w", l.namespace, l.name, err)
+	}
+	return nil
+}
+
+// Hold acquires the lease, runs fn while renewing the lease every third of its duration, then releases it.
+// The context of fn is canceled if the lease is lost, i.e. it's taken over or can not be renewed before it
+// expires.
+func (l *ClusterLease) Hold(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+		defer cancel()
+		if err := l.Release(releaseCtx); err != nil {
+			logrus.Warnf("%v, it expires in %v", err, l.duration)
+		}
+	}()
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := l.keepRenewing(fnCtx); err != nil {
+			lost <- err
+			cancel()
+		}
+	}()
+
+	err := fn(fnCtx)
+	cancel()
+	<-done
+	select {
+	case lostErr := <-lost:
+		return fmt.Errorf("lost lease %s/%s, error: %w", l.namespace, l.name, lostErr)
+	default:
+	}
+	return err
+}
+
+// keepRenewing renews the lease until ctx is done. The error is returned once the lease is lost.
+func (l *ClusterLease) keepRenewing(ctx context.Context) error {
+	ticker := l.clock.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+	lastRenewed := l.clock.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+
+		err := l.Renew(ctx)
+		switch {
+		case err == nil:
+			lastRenewed = l.clock.Now()
+		case ctx.Err() != nil:
+			return nil
+		case apierrors.IsConflict(err) || apierrors.IsNotFound(err):
+			return fmt.Errorf("the lease is taken over or removed by another process")
+		case l.clock.Since(lastRenewed) >= l.duration:
+			return fmt.Errorf("the lease expired after failing to renew it, error: %w", err)
+		default:
+			logrus.Warnf("failed to renew lease %s/%s, retry later. error: %v", l.namespace, l.name, err)
+		}
+	}
+}
+
+func (l *ClusterLease) newLease() *coordinationv1.Lease {
+	now := metav1.NewMicroTime(l.clock.Now())
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.name,
+			Namespace: l.namespace,
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       pointer.String(l.holderIdentity),
+			LeaseDurationSeconds: pointer.Int32(int32(l.duration.Seconds())),
+			AcquireTime:          &now,
+			RenewTime:            &now,
+			LeaseTransitions:     pointer.Int32(0),
+		},
+	}
+}
+
+// leaseExpiresAt returns when the lease expires if it's not renewed, a lease never renewed has expired.
+func leaseExpiresAt(lease *coordinationv1.Lease) time.Time {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return time.Time{}
+	}
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+}
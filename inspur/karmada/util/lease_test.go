@@ -0,0 +1,287 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	testingclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	leaseTestClusterID = "cluster-id"
+	leaseTestDuration  = 30 * time.Second
+)
+
+var leasesResource = coordinationv1.SchemeGroupVersion.WithResource("leases")
+
+// trackLeaseResourceVersions makes the fake client keep the resource version of leases as the API server does:
+// every write bumps it, an update of a stale version conflicts and the preconditions of a delete are checked.
+func trackLeaseResourceVersions(client *fake.Clientset) {
+	var version int
+	bump := func(lease *coordinationv1.Lease) {
+		version++
+		lease.ResourceVersion = strconv.Itoa(version)
+	}
+	getLive := func(namespace, name string) (*coordinationv1.Lease, error) {
+		obj, err := client.Tracker().Get(leasesResource, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return obj.(*coordinationv1.Lease), nil
+	}
+	conflict := func(name string) error {
+		return apierrors.NewConflict(coordinationv1.Resource("leases"), name, fmt.Errorf("the object has been modified"))
+	}
+
+	client.PrependReactor("create", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		lease := action.(clienttesting.CreateAction).GetObject().(*coordinationv1.Lease)
+		lease.UID = uuid.NewUUID()
+		bump(lease)
+		return false, nil, nil
+	})
+	client.PrependReactor("update", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		lease := action.(clienttesting.UpdateAction).GetObject().(*coordinationv1.Lease)
+		live, err := getLive(action.GetNamespace(), lease.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		if live.ResourceVersion != lease.ResourceVersion {
+			return true, nil, conflict(lease.Name)
+		}
+		bump(lease)
+		return false, nil, nil
+	})
+	client.PrependReactor("delete", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(clienttesting.DeleteAction)
+		live, err := getLive(action.GetNamespace(), deleteAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		preconditions := deleteAction.GetDeleteOptions().Preconditions
+		if preconditions != nil && ((preconditions.UID != nil && *preconditions.UID != live.UID) ||
+			(preconditions.ResourceVersion != nil && *preconditions.ResourceVersion != live.ResourceVersion)) {
+			return true, nil, conflict(live.Name)
+		}
+		return false, nil, nil
+	})
+}
+
+func newLeaseTestClient(objects ...runtime.Object) *fake.Clientset {
+	// the fake client does not create objects by apply, so the namespace applied by Acquire exists already.
+	objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: JoinLeaseNamespace}})
+	client := fake.NewSimpleClientset(objects...)
+	trackLeaseResourceVersions(client)
+	return client
+}
+
+func newLeaseTestLease(client *fake.Clientset, holderIdentity string, fakeClock *testingclock.FakeClock) *ClusterLease {
+	return NewClusterLease(client, leaseTestClusterID, holderIdentity, leaseTestDuration).WithClock(fakeClock)
+}
+
+// newHeldLease returns a lease of the test cluster held by holderIdentity and last renewed at renewTime.
+func newHeldLease(holderIdentity string, renewTime time.Time) *coordinationv1.Lease {
+	renewed := metav1.NewMicroTime(renewTime)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: JoinLeaseNamespace, Name: joinLeaseNamePrefix + leaseTestClusterID, UID: "held-uid"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       pointer.String(holderIdentity),
+			LeaseDurationSeconds: pointer.Int32(int32(leaseTestDuration.Seconds())),
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+			LeaseTransitions:     pointer.Int32(0),
+		},
+	}
+}
+
+func getTestLease(t *testing.T, client *fake.Clientset) *coordinationv1.Lease {
+	t.Helper()
+	lease, err := client.CoordinationV1().Leases(JoinLeaseNamespace).Get(context.TODO(), joinLeaseNamePrefix+leaseTestClusterID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lease
+}
+
+func TestClusterLeaseAcquire(t *testing.T) {
+	client := newLeaseTestClient()
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	if err := newLeaseTestLease(client, "holder", fakeClock).Acquire(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lease := getTestLease(t, client)
+	if holder := pointer.StringDeref(lease.Spec.HolderIdentity, ""); holder != "holder" {
+		t.Errorf("expected the lease held by holder, got %q", holder)
+	}
+	if expiresAt := leaseExpiresAt(lease); !expiresAt.Equal(fakeClock.Now().Add(leaseTestDuration)) {
+		t.Errorf("expected the lease to expire at %v, got %v", fakeClock.Now().Add(leaseTestDuration), expiresAt)
+	}
+}
+
+func TestClusterLeaseAcquireHeld(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	client := newLeaseTestClient(newHeldLease("other", fakeClock.Now()))
+	fakeClock.Step(leaseTestDuration - time.Second)
+
+	err := newLeaseTestLease(client, "holder", fakeClock).Acquire(context.TODO())
+	var heldErr *LeaseHeldError
+	if !errors.As(err, &heldErr) {
+		t.Fatalf("expected a LeaseHeldError, got %v", err)
+	}
+	if heldErr.Holder != "other" {
+		t.Errorf("expected the lease held by other, got %q", heldErr.Holder)
+	}
+	if holder := pointer.StringDeref(getTestLease(t, client).Spec.HolderIdentity, ""); holder != "other" {
+		t.Errorf("expected the live lease kept by other, got %q", holder)
+	}
+}
+
+func TestClusterLeaseTakeOverExpired(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	client := newLeaseTestClient(newHeldLease("other", fakeClock.Now()))
+	fakeClock.Step(leaseTestDuration + time.Second)
+
+	if err := newLeaseTestLease(client, "holder", fakeClock).Acquire(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lease := getTestLease(t, client)
+	if holder := pointer.StringDeref(lease.Spec.HolderIdentity, ""); holder != "holder" {
+		t.Errorf("expected the stale lease taken over by holder, got %q", holder)
+	}
+	if transitions := pointer.Int32Deref(lease.Spec.LeaseTransitions, 0); transitions != 1 {
+		t.Errorf("expected 1 lease transition, got %d", transitions)
+	}
+}
+
+func TestClusterLeaseConcurrentTakeOver(t *testing.T) {
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	client := newLeaseTestClient(newHeldLease("other", fakeClock.Now()))
+	fakeClock.Step(leaseTestDuration + time.Second)
+	// another process takes the stale lease over right after it's read.
+	var read bool
+	client.PrependReactor("get", "leases", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if read {
+			return false, nil, nil
+		}
+		read = true
+		obj, err := client.Tracker().Get(leasesResource, action.GetNamespace(), action.(clienttesting.GetAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		racer := newHeldLease("racer", fakeClock.Now())
+		racer.ResourceVersion = "racer"
+		if err := client.Tracker().Update(leasesResource, racer, racer.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+
+	err := newLeaseTestLease(client, "holder", fakeClock).Acquire(context.TODO())
+	if err == nil || !strings.Contains(err.Error(), "taken over by another process") {
+		t.Fatalf("expected a conflict taking over the lease, got %v", err)
+	}
+	if holder := pointer.StringDeref(getTestLease(t, client).Spec.HolderIdentity, ""); holder != "racer" {
+		t.Errorf("expected the lease kept by racer, got %q", holder)
+	}
+}
+
+func TestClusterLeaseRelease(t *testing.T) {
+	client := newLeaseTestClient()
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	lease := newLeaseTestLease(client, "holder", fakeClock)
+	if err := lease.Acquire(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Release(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := client.CoordinationV1().Leases(JoinLeaseNamespace).Get(context.TODO(), joinLeaseNamePrefix+leaseTestClusterID, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the released lease deleted, got %v", err)
+	}
+}
+
+func TestClusterLeaseReleaseTakenOver(t *testing.T) {
+	client := newLeaseTestClient()
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	lease := newLeaseTestLease(client, "holder", fakeClock)
+	if err := lease.Acquire(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	fakeClock.Step(leaseTestDuration + time.Second)
+	if err := newLeaseTestLease(client, "other", fakeClock).Acquire(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the preconditions of the delete keep the lease of the new holder.
+	if err := lease.Release(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if holder := pointer.StringDeref(getTestLease(t, client).Spec.HolderIdentity, ""); holder != "other" {
+		t.Errorf("expected the lease kept by other, got %q", holder)
+	}
+}
+
+func TestClusterLeaseHoldLost(t *testing.T) {
+	client := newLeaseTestClient()
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- newLeaseTestLease(client, "holder", fakeClock).Hold(context.Background(), func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	<-started
+	for !fakeClock.HasWaiters() {
+		time.Sleep(time.Millisecond)
+	}
+	// another process takes the lease over, so that the next renewal conflicts.
+	taken := getTestLease(t, client)
+	taken.Spec.HolderIdentity = pointer.String("other")
+	if _, err := client.CoordinationV1().Leases(JoinLeaseNamespace).Update(context.TODO(), taken, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	fakeClock.Step(leaseTestDuration / 3)
+
+	select {
+	case err := <-result:
+		if err == nil || !strings.Contains(err.Error(), "lost lease") {
+			t.Fatalf("expected the lease lost, got %v", err)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("fn is not canceled after the lease is lost")
+	}
+	if holder := pointer.StringDeref(getTestLease(t, client).Spec.HolderIdentity, ""); holder != "other" {
+		t.Errorf("expected the lease kept by other, got %q", holder)
+	}
+}
+
+func TestClusterLeaseDurationRoundedUp(t *testing.T) {
+	client := newLeaseTestClient()
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	if err := NewClusterLease(client, leaseTestClusterID, "holder", 1500*time.Millisecond).WithClock(fakeClock).Acquire(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seconds := pointer.Int32Deref(getTestLease(t, client).Spec.LeaseDurationSeconds, 0); seconds != 2 {
+		t.Errorf("expected the lease duration rounded up to 2s, got %ds", seconds)
+	}
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+// metricsNamespace is the prefix of all the metrics.
+const metricsNamespace = "k8s_study"
+
+// The results of the issued tokens.
+const (
+	TokenResultIssued = "issued"
+	TokenResultFailed = "failed"
+)
+
+// metricsRegistry holds the metrics of this module only, the metrics of client-go are left out.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	// TokensTotal counts the bootstrap tokens issued or failed to be issued.
+	TokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tokens_total",
+		Help:      "Number of the bootstrap tokens issued or failed to be issued.",
+	}, []string{"result"})
+
+	// HTTPRequestDuration observes the latency of the HTTP requests by route and status code.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the HTTP requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// JoinStepDuration observes how long each step of join takes.
+	JoinStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "join_step_duration_seconds",
+		Help:      "Duration of the steps of joining a member cluster by step and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"step", "outcome"})
+
+	// JoinsTotal counts the joins by outcome, the failed joins are told apart by the reason of the failure.
+	JoinsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "joins_total",
+		Help:      "Number of the joins by outcome and failure reason.",
+	}, []string{"outcome", "reason"})
+
+	// ServiceAccountSecretWaitDuration observes how long it takes for the token secret of a ServiceAccount to be populated.
+	ServiceAccountSecretWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "service_account_secret_wait_seconds",
+		Help:      "Time waited for the token secret of a ServiceAccount by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"result"})
+
+	// RegisteredClusters is the number of the clusters registered in control plane.
+	RegisteredClusters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "registered_clusters",
+		Help:      "Number of the clusters registered in karmada control plane by sync mode, provider and region.",
+	}, []string{"sync_mode", "provider", "region"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		TokensTotal,
+		HTTPRequestDuration,
+		JoinStepDuration,
+		JoinsTotal,
+		ServiceAccountSecretWaitDuration,
+		RegisteredClusters,
+	)
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// UpdateRegisteredClusters sets the number of the registered clusters from the clusters listed.
+func UpdateRegisteredClusters(clusters []clusterv1alpha1.Cluster) {
+	RegisteredClusters.Reset()
+	for _, cluster := range clusters {
+		RegisteredClusters.WithLabelValues(string(cluster.Spec.SyncMode), cluster.Spec.Provider, cluster.Spec.Region).Inc()
+	}
+}
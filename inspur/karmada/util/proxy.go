@@ -0,0 +1,98 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// supportedProxySchemes are the schemes of proxy url that can be used to reach member clusters.
+var supportedProxySchemes = sets.NewString("http", "https", "socks5")
+
+// ParseProxyURL parses the proxy url and checks that its scheme is supported.
+func ParseProxyURL(proxyURL string) (*url.URL, error) {
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if !supportedProxySchemes.Has(proxy.Scheme) {
+		return nil, fmt.Errorf("unsupported scheme %q of proxy url %s, should be one of %v", proxy.Scheme, proxyURL, supportedProxySchemes.List())
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("the host of proxy url %s is empty", proxyURL)
+	}
+	return proxy, nil
+}
+
+// SetProxy makes the rest config reach the cluster through the proxy. The proxyHeader is sent to the proxy
+// when tunneling the connection, the values of a header are separated by comma.
+func SetProxy(config *rest.Config, proxy *url.URL, proxyHeader map[string]string) {
+	config.Proxy = http.ProxyURL(proxy)
+	if len(proxyHeader) == 0 {
+		return
+	}
+
+	header := http.Header{}
+	for key, values := range proxyHeader {
+		for _, value := range strings.Split(values, ",") {
+			header.Add(key, strings.TrimSpace(value))
+		}
+	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		if tr, ok := rt.(*http.Transport); ok {
+			tr.ProxyConnectHeader = header
+		}
+		return rt
+	})
+}
+
+// ResolveProxy resolves the proxy that the rest config uses for a request to endpoint.
+// It returns nil if the endpoint is reached directly.
+func ResolveProxy(config *rest.Config, endpoint string) (*url.URL, error) {
+	if config.Proxy == nil {
+		return nil, nil
+	}
+
+	// proxy funcs like http.ProxyFromEnvironment decide the proxy by the request, so a synthetic one is made.
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request to %s, error: %w", endpoint, err)
+	}
+	return config.Proxy(req)
+}
+
+// CheckClusterConnectivity makes sure the cluster can be reached with the rest config by a discovery call.
+func CheckClusterConnectivity(ctx context.Context, config *rest.Config, timeout time.Duration) error {
+	config = rest.CopyConfig(config)
+	config.Timeout = timeout
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	_, err = ServerVersion(ctx, discoveryClient)
+	return err
+}
+
+// ServerVersion retrieves the version of the cluster like discovery does, but the request is
+// canceled once ctx is done.
+func ServerVersion(ctx context.Context, discoveryClient discovery.DiscoveryInterface) (*version.Info, error) {
+	body, err := discoveryClient.RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	var info version.Info
+	if err = json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse the server version: %v", err)
+	}
+	return &info, nil
+}
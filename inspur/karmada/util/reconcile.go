@@ -0,0 +1,16 @@
+package util
+
+// OperationResult is the action result of an Ensure or Apply helper.
+type OperationResult string
+
+const (
+	// OperationResultCreated means the object did not exist and was created.
+	OperationResultCreated OperationResult = "created"
+	// OperationResultUpdated means the object existed and was updated as its live state differed from the desired one.
+	OperationResultUpdated OperationResult = "updated"
+	// OperationResultUnchanged means the object existed in the desired state, or nothing was done in dry-run mode.
+	OperationResultUnchanged OperationResult = "unchanged"
+	// OperationResultApplied means the object was applied without being read first, so whether it was created,
+	// updated or unchanged is not known.
+	OperationResultApplied OperationResult = "applied"
+)
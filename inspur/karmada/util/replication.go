@@ -0,0 +1,435 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// ReplicatedFromAnnotation is set on the replicated secrets, it tells the source secret as cluster/namespace/name.
+const ReplicatedFromAnnotation = "k8s-study.io/replicated-from"
+
+// The types of the transforms applied to the replicated data.
+const (
+	// TransformRenameKey moves the value of Key to To.
+	TransformRenameKey = "RenameKey"
+	// TransformBase64 replaces the value of Key with its base64 encoding.
+	TransformBase64 = "Base64"
+	// TransformKubeconfig builds a kubeconfig from the token in TokenKey and the CA in CAKey, and stores it in To.
+	TransformKubeconfig = "Kubeconfig"
+)
+
+// ReplicationSpec describes the secrets replicated across clusters.
+type ReplicationSpec struct {
+	// Clusters are the clusters the secrets are replicated between, by name.
+	Clusters     map[string]ReplicationCluster `json:"clusters"`
+	Replications []SecretReplication           `json:"replications"`
+}
+
+// ReplicationCluster is a cluster reached with a kubeconfig.
+type ReplicationCluster struct {
+	Kubeconfig string `json:"kubeconfig"`
+	// Context is the context in the kubeconfig, the current context is used if it's empty.
+	Context string `json:"context,omitempty"`
+}
+
+// SecretLocation is a secret in one of the clusters.
+type SecretLocation struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name,omitempty"`
+	// ServiceAccount takes the newest token secret of the ServiceAccount as the source instead of Name, as the
+	// token secrets are named by the token controller.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+}
+
+func (l SecretLocation) String() string {
+	name := l.Name
+	if l.ServiceAccount != "" {
+		name = "serviceaccount:" + l.ServiceAccount
+	}
+	return fmt.Sprintf("%s/%s/%s", l.Cluster, l.Namespace, name)
+}
+
+// SecretReplication copies the data of the source secret to the target secret.
+type SecretReplication struct {
+	Name   string         `json:"name"`
+	Source SecretLocation `json:"source"`
+	Target SecretLocation `json:"target"`
+	// Keys maps the keys of the source secret to the keys of the target secret, all the keys are copied as they
+	// are if it's empty.
+	Keys map[string]string `json:"keys,omitempty"`
+	// Transforms are applied in order to the mapped data.
+	Transforms []ReplicationTransform `json:"transforms,omitempty"`
+}
+
+// ReplicationTransform changes the replicated data before it's written to the target secret.
+type ReplicationTransform struct {
+	Type string `json:"type"`
+	Key  string `json:"key,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Server is the server of the kubeconfig, it defaults to the server of the source cluster.
+	Server string `json:"server,omitempty"`
+	// TokenKey and CAKey are the keys of the token and the CA of the kubeconfig, they default to token and ca.crt.
+	TokenKey string `json:"tokenKey,omitempty"`
+	CAKey    string `json:"caKey,omitempty"`
+}
+
+// LoadReplicationSpec reads and validates the spec in the YAML file, unknown fields are refused.
+func LoadReplicationSpec(path string) (*ReplicationSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &ReplicationSpec{}
+	if err = yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, fmt.Errorf("failed to parse replication spec %s, error: %v", path, err)
+	}
+	if err = spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid replication spec %s, error: %v", path, err)
+	}
+	return spec, nil
+}
+
+// Validate checks the replications refer to the clusters of the spec and their transforms are complete.
+func (s *ReplicationSpec) Validate() error {
+	var errs field.ErrorList
+	for name, cluster := range s.Clusters {
+		if cluster.Kubeconfig == "" {
+			errs = append(errs, field.Required(field.NewPath("clusters").Key(name).Child("kubeconfig"), ""))
+		}
+	}
+
+	names := sets.NewString()
+	targets := sets.NewString()
+	for i, replication := range s.Replications {
+		path := field.NewPath("replications").Index(i)
+		if replication.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		} else if names.Has(replication.Name) {
+			errs = append(errs, field.Duplicate(path.Child("name"), replication.Name))
+		}
+		names.Insert(replication.Name)
+
+		errs = append(errs, s.validateLocation(replication.Source, path.Child("source"), true)...)
+		errs = append(errs, s.validateLocation(replication.Target, path.Child("target"), false)...)
+		if targets.Has(replication.Target.String()) {
+			errs = append(errs, field.Duplicate(path.Child("target"), replication.Target.String()))
+		}
+		targets.Insert(replication.Target.String())
+		if replication.Target.String() == replication.Source.String() {
+			errs = append(errs, field.Invalid(path.Child("target"), replication.Target.String(), "the target is the source secret itself"))
+		}
+
+		sourceKeys := make([]string, 0, len(replication.Keys))
+		for sourceKey := range replication.Keys {
+			sourceKeys = append(sourceKeys, sourceKey)
+		}
+		sort.Strings(sourceKeys)
+		targetKeys := sets.NewString()
+		for _, sourceKey := range sourceKeys {
+			targetKey := replication.Keys[sourceKey]
+			if targetKeys.Has(targetKey) {
+				errs = append(errs, field.Duplicate(path.Child("keys").Key(sourceKey), targetKey))
+			}
+			targetKeys.Insert(targetKey)
+		}
+
+		for j, transform := range replication.Transforms {
+			transformPath := path.Child("transforms").Index(j)
+			switch transform.Type {
+			case TransformRenameKey:
+				if transform.Key == "" || transform.To == "" {
+					errs = append(errs, field.Required(transformPath, "key and to are required to rename a key"))
+				}
+			case TransformBase64:
+				if transform.Key == "" {
+					errs = append(errs, field.Required(transformPath.Child("key"), ""))
+				}
+			case TransformKubeconfig:
+				if transform.To == "" {
+					errs = append(errs, field.Required(transformPath.Child("to"), "the key of the kubeconfig is required"))
+				}
+			default:
+				errs = append(errs, field.NotSupported(transformPath.Child("type"), transform.Type,
+					[]string{TransformRenameKey, TransformBase64, TransformKubeconfig}))
+			}
+		}
+	}
+	if cycle := s.replicationCycle(); cycle != nil {
+		errs = append(errs, field.Invalid(field.NewPath("replications"), strings.Join(append(cycle, cycle[0]), " -> "),
+			"the replications copy the secrets in a cycle"))
+	}
+	return errs.ToAggregate()
+}
+
+// replicationCycle returns the names of the replications in a cycle, each writing the source of the next one,
+// or nil if there is none. A replication writing its own source is left to the check of its target.
+func (s *ReplicationSpec) replicationCycle() []string {
+	byTarget := map[string]int{}
+	for i, replication := range s.Replications {
+		if _, ok := byTarget[replication.Target.String()]; !ok {
+			byTarget[replication.Target.String()] = i
+		}
+	}
+	for start := range s.Replications {
+		// walk back through the replications writing the source, the targets are unique so there is at most one.
+		cycle := []string{s.Replications[start].Name}
+		for current, steps := start, 0; steps < len(s.Replications); steps++ {
+			previous, ok := byTarget[s.Replications[current].Source.String()]
+			if !ok || previous == current {
+				break
+			}
+			if previous == start {
+				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			cycle = append(cycle, s.Replications[previous].Name)
+			current = previous
+		}
+	}
+	return nil
+}
+
+func (s *ReplicationSpec) validateLocation(location SecretLocation, path *field.Path, source bool) field.ErrorList {
+	var errs field.ErrorList
+	if _, ok := s.Clusters[location.Cluster]; !ok {
+		errs = append(errs, field.NotFound(path.Child("cluster"), location.Cluster))
+	}
+	if location.Namespace == "" {
+		errs = append(errs, field.Required(path.Child("namespace"), ""))
+	}
+	switch {
+	case location.ServiceAccount != "" && !source:
+		errs = append(errs, field.Forbidden(path.Child("serviceAccount"), "only the source can be the token secret of a ServiceAccount"))
+	case location.ServiceAccount != "" && location.Name != "":
+		errs = append(errs, field.Forbidden(path.Child("name"), "name can not be combined with serviceAccount"))
+	case location.ServiceAccount == "" && location.Name == "":
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	return errs
+}
+
+// ReplicationResult is the result of replicating a secret once.
+type ReplicationResult struct {
+	Replication string
+	Operation   OperationResult
+	// DriftedKeys are the keys of the target secret whose values differ from the replicated ones.
+	DriftedKeys []string
+}
+
+// SecretReplicator replicates the secrets of a spec.
+type SecretReplicator struct {
+	spec    *ReplicationSpec
+	clients map[string]kubeclient.Interface
+	servers map[string]string
+	// DryRun only detects the drifts, nothing is written.
+	DryRun   bool
+	auditLog *AuditLog
+}
+
+// NewSecretReplicator builds the clients of the clusters in the spec, the writes are recorded to auditLog if
+// it's not nil.
+func NewSecretReplicator(spec *ReplicationSpec, auditLog *AuditLog) (*SecretReplicator, error) {
+	r := &SecretReplicator{
+		spec:     spec,
+		clients:  map[string]kubeclient.Interface{},
+		servers:  map[string]string{},
+		auditLog: auditLog,
+	}
+	for name, cluster := range spec.Clusters {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: cluster.Kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: cluster.Context}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig of cluster %s, error: %v", name, err)
+		}
+		client, err := kubeclient.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		r.clients[name] = client
+		r.servers[name] = config.Host
+	}
+	return r, nil
+}
+
+// ReplicateAll replicates every secret of the spec once, the errors of all the replications are returned.
+func (r *SecretReplicator) ReplicateAll(ctx context.Context) ([]ReplicationResult, error) {
+	var (
+		results []ReplicationResult
+		errs    []error
+	)
+	for _, replication := range r.spec.Replications {
+		result, err := r.Replicate(ctx, replication)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("replication %s failed, error: %v", replication.Name, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, utilerrors.NewAggregate(errs)
+}
+
+// Replicate copies the transformed data of the source secret to the target secret. Only the replicated keys
+// are compared, a target secret whose values differ is reported as drifted and written again.
+func (r *SecretReplicator) Replicate(ctx context.Context, replication SecretReplication) (ReplicationResult, error) {
+	result := ReplicationResult{Replication: replication.Name, Operation: OperationResultUnchanged}
+	source, err := r.getSourceSecret(ctx, replication.Source)
+	if err != nil {
+		return result, err
+	}
+	data, err := r.transform(replication, source.Data)
+	if err != nil {
+		return result, err
+	}
+
+	target, err := r.clients[replication.Target.Cluster].CoreV1().Secrets(replication.Target.Namespace).
+		Get(ctx, replication.Target.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		result.Operation = OperationResultCreated
+	case err != nil:
+		return result, err
+	default:
+		for key, value := range data {
+			if !bytes.Equal(target.Data[key], value) {
+				result.DriftedKeys = append(result.DriftedKeys, key)
+			}
+		}
+		sort.Strings(result.DriftedKeys)
+		if len(result.DriftedKeys) == 0 {
+			return result, nil
+		}
+		result.Operation = OperationResultUpdated
+		logrus.Warnf("replication %s: target secret %s drifted on keys %v", replication.Name, replication.Target, result.DriftedKeys)
+	}
+	if r.DryRun {
+		return result, nil
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        replication.Target.Name,
+			Namespace:   replication.Target.Namespace,
+			Annotations: map[string]string{ReplicatedFromAnnotation: fmt.Sprintf("%s/%s/%s", replication.Source.Cluster, source.Namespace, source.Name)},
+		},
+		Data: data,
+	}
+	// the target is compared above already, so the result of the apply is not reported.
+	_, _, err = ApplySecret(ctx, r.clients[replication.Target.Cluster], secret, ApplyOptions{Force: true})
+	r.audit(replication, source, err)
+	return result, err
+}
+
+// getSourceSecret returns the source secret, or the newest token secret of the source ServiceAccount.
+func (r *SecretReplicator) getSourceSecret(ctx context.Context, location SecretLocation) (*corev1.Secret, error) {
+	client := r.clients[location.Cluster]
+	if location.ServiceAccount == "" {
+		return client.CoreV1().Secrets(location.Namespace).Get(ctx, location.Name, metav1.GetOptions{})
+	}
+	serviceAccount, err := client.CoreV1().ServiceAccounts(location.Namespace).Get(ctx, location.ServiceAccount, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return GetServiceAccountTokenSecret(ctx, client, serviceAccount)
+}
+
+// transform maps the keys of the source data, then applies the transforms in order.
+func (r *SecretReplicator) transform(replication SecretReplication, sourceData map[string][]byte) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	if len(replication.Keys) == 0 {
+		for key, value := range sourceData {
+			data[key] = value
+		}
+	}
+	for sourceKey, targetKey := range replication.Keys {
+		value, ok := sourceData[sourceKey]
+		if !ok {
+			return nil, fmt.Errorf("source secret %s has no key %q", replication.Source, sourceKey)
+		}
+		data[targetKey] = value
+	}
+
+	for _, transform := range replication.Transforms {
+		switch transform.Type {
+		case TransformRenameKey:
+			value, ok := data[transform.Key]
+			if !ok {
+				return nil, fmt.Errorf("can not rename the missing key %q", transform.Key)
+			}
+			delete(data, transform.Key)
+			data[transform.To] = value
+		case TransformBase64:
+			value, ok := data[transform.Key]
+			if !ok {
+				return nil, fmt.Errorf("can not encode the missing key %q", transform.Key)
+			}
+			data[transform.Key] = []byte(base64.StdEncoding.EncodeToString(value))
+		case TransformKubeconfig:
+			server, tokenKey, caKey := transform.Server, transform.TokenKey, transform.CAKey
+			if server == "" {
+				server = r.servers[replication.Source.Cluster]
+			}
+			if tokenKey == "" {
+				tokenKey = corev1.ServiceAccountTokenKey
+			}
+			if caKey == "" {
+				caKey = corev1.ServiceAccountRootCAKey
+			}
+			for _, key := range []string{tokenKey, caKey} {
+				if _, ok := data[key]; !ok {
+					return nil, fmt.Errorf("can not build the kubeconfig from the missing key %q", key)
+				}
+			}
+			kubeconfig, err := BuildTokenKubeconfig(replication.Source.Cluster, server, data[caKey], data[tokenKey])
+			if err != nil {
+				return nil, err
+			}
+			data[transform.To] = kubeconfig
+		}
+	}
+	return data, nil
+}
+
+// audit records the write of the target secret.
+func (r *SecretReplicator) audit(replication SecretReplication, source *corev1.Secret, err error) {
+	if r.auditLog == nil {
+		return
+	}
+	record := &AuditRecord{
+		Operation: "replicate-secret",
+		Actor:     AuditActor(),
+		Objects: []string{
+			AuditObject("Secret", source.Namespace, source.Name),
+			AuditObject("Secret", replication.Target.Namespace, replication.Target.Name),
+		},
+		Details: map[string]string{
+			"replication":   replication.Name,
+			"sourceCluster": replication.Source.Cluster,
+			"targetCluster": replication.Target.Cluster,
+		},
+	}
+	record.Finish(err)
+	if auditErr := r.auditLog.Append(record); auditErr != nil {
+		logrus.Error(auditErr.Error())
+	}
+}
@@ -0,0 +1,242 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newReplicationTestSpec returns a spec of the replications between member1 and member2.
+func newReplicationTestSpec(replications ...SecretReplication) *ReplicationSpec {
+	return &ReplicationSpec{
+		Clusters: map[string]ReplicationCluster{
+			"member1": {Kubeconfig: "member1.config"},
+			"member2": {Kubeconfig: "member2.config"},
+		},
+		Replications: replications,
+	}
+}
+
+// newTestReplication returns a replication from the secret source in member1 to the secret target in member2.
+func newTestReplication(name, source, target string) SecretReplication {
+	return SecretReplication{
+		Name:   name,
+		Source: SecretLocation{Cluster: "member1", Namespace: "default", Name: source},
+		Target: SecretLocation{Cluster: "member2", Namespace: "default", Name: target},
+	}
+}
+
+func TestReplicationSpecValidate(t *testing.T) {
+	selfTarget := newTestReplication("self", "a", "a")
+	selfTarget.Target.Cluster = "member1"
+	cycleBack := newTestReplication("back", "b", "a")
+	cycleBack.Source.Cluster, cycleBack.Target.Cluster = "member2", "member1"
+	duplicateKeys := newTestReplication("keys", "a", "b")
+	duplicateKeys.Keys = map[string]string{"token": "value", "ca.crt": "value"}
+	incompleteTransforms := newTestReplication("transforms", "a", "b")
+	incompleteTransforms.Transforms = []ReplicationTransform{{Type: TransformRenameKey, Key: "token"}, {Type: TransformKubeconfig}, {Type: "Gzip"}}
+	serviceAccountTarget := newTestReplication("sa", "a", "")
+	serviceAccountTarget.Source.Cluster = "member3"
+	serviceAccountTarget.Target.ServiceAccount = "karmada-member1"
+
+	tests := []struct {
+		name         string
+		spec         *ReplicationSpec
+		expectedErrs []string
+	}{
+		{
+			name: "valid",
+			spec: newReplicationTestSpec(newTestReplication("a-to-b", "a", "b"), newTestReplication("c-to-d", "c", "d")),
+		},
+		{
+			name:         "target is the source",
+			spec:         newReplicationTestSpec(selfTarget),
+			expectedErrs: []string{"the target is the source secret itself"},
+		},
+		{
+			name:         "cycle",
+			spec:         newReplicationTestSpec(newTestReplication("forth", "a", "b"), cycleBack),
+			expectedErrs: []string{"back -> forth -> back", "the replications copy the secrets in a cycle"},
+		},
+		{
+			name:         "duplicate target secrets",
+			spec:         newReplicationTestSpec(newTestReplication("a-to-b", "a", "b"), newTestReplication("c-to-b", "c", "b")),
+			expectedErrs: []string{"replications[1].target: Duplicate value"},
+		},
+		{
+			name:         "duplicate target keys",
+			spec:         newReplicationTestSpec(duplicateKeys),
+			expectedErrs: []string{"replications[0].keys[token]: Duplicate value"},
+		},
+		{
+			name: "incomplete transforms",
+			spec: newReplicationTestSpec(incompleteTransforms),
+			expectedErrs: []string{"replications[0].transforms[0]: Required value", "replications[0].transforms[1].to: Required value",
+				`replications[0].transforms[2].type: Unsupported value: "Gzip"`},
+		},
+		{
+			name:         "unknown cluster and ServiceAccount target",
+			spec:         newReplicationTestSpec(serviceAccountTarget),
+			expectedErrs: []string{"replications[0].source.cluster: Not found", "only the source can be the token secret of a ServiceAccount"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if len(tt.expectedErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got nil", tt.expectedErrs)
+			}
+			for _, expected := range tt.expectedErrs {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected the error to contain %q, got %v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReplicationSpecReplicationCycle(t *testing.T) {
+	// in the cycle every replication writes the source of the next one, it ends with the first replication of the spec.
+	loop := func(name, source, target string) SecretReplication {
+		r := newTestReplication(name, source, target)
+		r.Target.Cluster = "member1"
+		return r
+	}
+	tests := []struct {
+		name     string
+		spec     *ReplicationSpec
+		expected []string
+	}{
+		{
+			name: "no cycle",
+			spec: newReplicationTestSpec(loop("a", "x", "y"), loop("b", "y", "z")),
+		},
+		{
+			name: "writing its own source",
+			spec: newReplicationTestSpec(loop("self", "x", "x")),
+		},
+		{
+			name:     "cycle",
+			spec:     newReplicationTestSpec(loop("a", "z", "x"), loop("b", "x", "y"), loop("c", "y", "z"), loop("chain", "w", "v")),
+			expected: []string{"b", "c", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cycle := tt.spec.replicationCycle(); !reflect.DeepEqual(cycle, tt.expected) {
+				t.Errorf("expected cycle %v, got %v", tt.expected, cycle)
+			}
+		})
+	}
+}
+
+func TestSecretReplicatorTransform(t *testing.T) {
+	sourceData := map[string][]byte{
+		corev1.ServiceAccountTokenKey:  []byte("token"),
+		corev1.ServiceAccountRootCAKey: []byte("ca"),
+	}
+	tests := []struct {
+		name        string
+		keys        map[string]string
+		transforms  []ReplicationTransform
+		expected    map[string][]byte
+		expectedErr string
+	}{
+		{
+			name:     "copy all keys",
+			expected: sourceData,
+		},
+		{
+			name:     "map keys",
+			keys:     map[string]string{corev1.ServiceAccountTokenKey: "bearer"},
+			expected: map[string][]byte{"bearer": []byte("token")},
+		},
+		{
+			name:        "map a missing key",
+			keys:        map[string]string{"namespace": "namespace"},
+			expectedErr: `has no key "namespace"`,
+		},
+		{
+			name: "rename and encode",
+			transforms: []ReplicationTransform{
+				{Type: TransformRenameKey, Key: corev1.ServiceAccountTokenKey, To: "bearer"},
+				{Type: TransformBase64, Key: "bearer"},
+			},
+			expected: map[string][]byte{"bearer": []byte("dG9rZW4="), corev1.ServiceAccountRootCAKey: []byte("ca")},
+		},
+		{
+			name:        "rename a missing key",
+			transforms:  []ReplicationTransform{{Type: TransformRenameKey, Key: "bearer", To: "token"}},
+			expectedErr: `can not rename the missing key "bearer"`,
+		},
+		{
+			name:        "encode a missing key",
+			transforms:  []ReplicationTransform{{Type: TransformBase64, Key: "bearer"}},
+			expectedErr: `can not encode the missing key "bearer"`,
+		},
+		{
+			name:        "kubeconfig from a missing token key",
+			transforms:  []ReplicationTransform{{Type: TransformKubeconfig, To: SecretKubeconfigKey, TokenKey: "bearer"}},
+			expectedErr: `can not build the kubeconfig from the missing key "bearer"`,
+		},
+		{
+			name:        "kubeconfig from a missing CA key",
+			keys:        map[string]string{corev1.ServiceAccountTokenKey: corev1.ServiceAccountTokenKey},
+			transforms:  []ReplicationTransform{{Type: TransformKubeconfig, To: SecretKubeconfigKey}},
+			expectedErr: `can not build the kubeconfig from the missing key "ca.crt"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replication := newTestReplication(tt.name, "a", "b")
+			replication.Keys, replication.Transforms = tt.keys, tt.transforms
+			r := &SecretReplicator{servers: map[string]string{"member1": "https://member1:6443"}}
+			data, err := r.transform(replication, sourceData)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.expected) {
+				t.Errorf("expected data %q, got %q", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestSecretReplicatorTransformKubeconfig(t *testing.T) {
+	replication := newTestReplication("kubeconfig", "a", "b")
+	replication.Transforms = []ReplicationTransform{{Type: TransformKubeconfig, To: SecretKubeconfigKey}}
+	r := &SecretReplicator{servers: map[string]string{"member1": "https://member1:6443"}}
+	data, err := r.transform(replication, map[string][]byte{
+		corev1.ServiceAccountTokenKey:  []byte("token"),
+		corev1.ServiceAccountRootCAKey: []byte("ca"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config, err := clientcmd.Load(data[SecretKubeconfigKey])
+	if err != nil {
+		t.Fatalf("failed to load the kubeconfig: %v", err)
+	}
+	if server := config.Clusters["member1"].Server; server != "https://member1:6443" {
+		t.Errorf("expected the server of the source cluster, got %q", server)
+	}
+	if token := config.AuthInfos["member1"].Token; token != "token" {
+		t.Errorf("expected the token of the source secret, got %q", token)
+	}
+}
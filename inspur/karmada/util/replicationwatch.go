@@ -0,0 +1,122 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Watch replicates the secrets whenever a source or target secret changes until ctx is done, so that a drifted
+// target is written back. The informers resync every resyncPeriod, the failed replications are retried with
+// backoff.
+func (r *SecretReplicator) Watch(ctx context.Context, resyncPeriod time.Duration) error {
+	defer utilruntime.HandleCrash()
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	replications := map[string]SecretReplication{}
+	for _, replication := range r.spec.Replications {
+		replications[replication.Name] = replication
+	}
+
+	// the informers are scoped to the namespaces of the secrets, one per cluster and namespace.
+	factories := map[string]informers.SharedInformerFactory{}
+	var cacheSyncs []cache.InformerSynced
+	watchNamespace := func(cluster, namespace string) {
+		key := cluster + "/" + namespace
+		if _, ok := factories[key]; ok {
+			return
+		}
+		factory := informers.NewSharedInformerFactoryWithOptions(r.clients[cluster], resyncPeriod, informers.WithNamespace(namespace))
+		informer := factory.Core().V1().Secrets().Informer()
+		informer.AddEventHandler(replicationHandler(queue, cluster, replications))
+		factories[key] = factory
+		cacheSyncs = append(cacheSyncs, informer.HasSynced)
+	}
+	for _, replication := range r.spec.Replications {
+		watchNamespace(replication.Source.Cluster, replication.Source.Namespace)
+		watchNamespace(replication.Target.Cluster, replication.Target.Namespace)
+	}
+
+	for _, factory := range factories {
+		factory.Start(ctx.Done())
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), cacheSyncs...) {
+		return fmt.Errorf("failed to wait for the caches of secret replicator to sync")
+	}
+	for name := range replications {
+		queue.Add(name)
+	}
+
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextReplication(ctx, queue, replications) {
+		}
+	}, time.Second)
+	<-ctx.Done()
+	return nil
+}
+
+// replicationHandler enqueues the replications whose source or target is the changed secret of cluster, the
+// tombstone of a deleted secret is unwrapped.
+func replicationHandler(queue workqueue.RateLimitingInterface, cluster string, replications map[string]SecretReplication) cache.ResourceEventHandler {
+	enqueue := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		secret, ok := obj.(*corev1.Secret)
+		if !ok {
+			return
+		}
+		for name, replication := range replications {
+			if replication.Source.matches(cluster, secret) || replication.Target.matches(cluster, secret) {
+				queue.Add(name)
+			}
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, newObj interface{}) { enqueue(newObj) },
+		DeleteFunc: enqueue,
+	}
+}
+
+// matches tells whether the secret of cluster is the one at the location, or a token secret of the
+// ServiceAccount at the location.
+func (l SecretLocation) matches(cluster string, secret *corev1.Secret) bool {
+	if l.Cluster != cluster || l.Namespace != secret.Namespace {
+		return false
+	}
+	if l.ServiceAccount != "" {
+		return secret.Type == corev1.SecretTypeServiceAccountToken && secret.Annotations[corev1.ServiceAccountNameKey] == l.ServiceAccount
+	}
+	return l.Name == secret.Name
+}
+
+func (r *SecretReplicator) processNextReplication(ctx context.Context, queue workqueue.RateLimitingInterface, replications map[string]SecretReplication) bool {
+	key, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(key)
+
+	replication := replications[key.(string)]
+	result, err := r.Replicate(ctx, replication)
+	if err != nil {
+		logrus.Errorf("failed to replicate secret %s to %s, retry later. error: %v", replication.Source, replication.Target, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+	if result.Operation != OperationResultUnchanged {
+		logrus.Infof("replication %s: secret %s %s", replication.Name, replication.Target, result.Operation)
+	}
+	queue.Forget(key)
+	return true
+}
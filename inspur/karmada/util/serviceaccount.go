@@ -8,84 +8,90 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	kubeclient "k8s.io/client-go/kubernetes"
 )
 
-// CreateServiceAccount just try to create the ServiceAccount.
-func CreateServiceAccount(client kubeclient.Interface, saObj *corev1.ServiceAccount) (*corev1.ServiceAccount, error) {
-	_, err := client.CoreV1().ServiceAccounts(saObj.Namespace).Create(context.TODO(), saObj, metav1.CreateOptions{})
-	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			return saObj, nil
-		}
+// DefaultServiceAccountSecretTimeout is the default time to wait for the token secret of a ServiceAccount.
+const DefaultServiceAccountSecretTimeout = 30 * time.Second
 
-		return nil, err
-	}
+// serviceAccountSecretPollInterval is the interval to check the token secret of a ServiceAccount.
+const serviceAccountSecretPollInterval = 1 * time.Second
 
-	return saObj, nil
-}
-
-// IsServiceAccountExist tells if specific service account already exists.
-func IsServiceAccountExist(client kubeclient.Interface, namespace string, name string) (bool, error) {
-	_, err := client.CoreV1().ServiceAccounts(namespace).Get(context.Background(), name, metav1.GetOptions{})
+// WaitForServiceAccountSecretCreation wait the ServiceAccount's secret has been created, until timeout
+// or ctx is done.
+func WaitForServiceAccountSecretCreation(ctx context.Context, client kubeclient.Interface, asObj *corev1.ServiceAccount, timeout time.Duration) (*corev1.Secret, error) {
+	start := time.Now()
+	clusterSecret, err := NewServiceAccountSecretWaiter(client, timeout).Wait(ctx, asObj)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return false, nil
-		}
-
-		return false, err
+		ServiceAccountSecretWaitDuration.WithLabelValues("failed").Observe(time.Since(start).Seconds())
+		return nil, fmt.Errorf("failed to get serviceAccount secret, error: %w", err)
 	}
-
-	return true, nil
+	ServiceAccountSecretWaitDuration.WithLabelValues("obtained").Observe(time.Since(start).Seconds())
+	return clusterSecret, nil
 }
 
-// EnsureServiceAccountExist makes sure that the specific service account exist in cluster.
-// If service account not exist, just create it.
-func EnsureServiceAccountExist(client kubeclient.Interface, serviceAccountObj *corev1.ServiceAccount, dryRun bool) (*corev1.ServiceAccount, error) {
-	if dryRun {
-		return serviceAccountObj, nil
+// CreateServiceAccountTokenSecret creates a new token secret for the ServiceAccount and
+// waits until the token controller of the cluster fills the token into it, until timeout or ctx is done.
+func CreateServiceAccountTokenSecret(ctx context.Context, client kubeclient.Interface, saObj *corev1.ServiceAccount, timeout time.Duration) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    saObj.Namespace,
+			GenerateName: fmt.Sprintf("%s-token-", saObj.Name),
+			Annotations: map[string]string{
+				corev1.ServiceAccountNameKey: saObj.Name,
+			},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
 	}
-
-	exist, err := IsServiceAccountExist(client, serviceAccountObj.Namespace, serviceAccountObj.Name)
+	createdObj, err := client.CoreV1().Secrets(saObj.Namespace).Create(ctx, secret, metav1.CreateOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if service account exist. service account: %s/%s, error: %v", serviceAccountObj.Namespace, serviceAccountObj.Name, err)
+		return nil, err
 	}
-	if exist {
-		return serviceAccountObj, nil
+
+	tokenSecret, err := NewServiceAccountSecretWaiter(client, timeout).WaitForSecret(ctx, saObj, createdObj.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait token populated into secret %s/%s, error: %w", createdObj.Namespace, createdObj.Name, err)
 	}
+	return tokenSecret, nil
+}
 
-	createdObj, err := CreateServiceAccount(client, serviceAccountObj)
+// ListServiceAccountTokenSecrets lists the token secrets issued for the ServiceAccount.
+func ListServiceAccountTokenSecrets(ctx context.Context, client kubeclient.Interface, saObj *corev1.ServiceAccount) ([]corev1.Secret, error) {
+	secretList, err := client.CoreV1().Secrets(saObj.Namespace).List(ctx, metav1.ListOptions{FieldSelector: tokenSecretFieldSelector})
 	if err != nil {
-		return nil, fmt.Errorf("ensure service account failed due to create failed. service account: %s/%s, error: %v", serviceAccountObj.Namespace, serviceAccountObj.Name, err)
+		return nil, err
 	}
 
-	return createdObj, nil
+	var secrets []corev1.Secret
+	for _, secret := range secretList.Items {
+		if secret.Annotations[corev1.ServiceAccountNameKey] == saObj.Name {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets, nil
 }
 
-// WaitForServiceAccountSecretCreation wait the ServiceAccount's secret has been created.
-func WaitForServiceAccountSecretCreation(client kubeclient.Interface, asObj *corev1.ServiceAccount) (*corev1.Secret, error) {
-	var clusterSecret *corev1.Secret
-	err := wait.Poll(1*time.Second, 30*time.Second, func() (done bool, err error) {
-		serviceAccount, err := client.CoreV1().ServiceAccounts(asObj.Namespace).Get(context.TODO(), asObj.Name, metav1.GetOptions{})
-		if err != nil {
-			if apierrors.IsNotFound(err) {
-				return false, nil
-			}
-			return false, fmt.Errorf("failed to retrieve service account(%s/%s) from cluster, err: %v", asObj.Namespace, asObj.Name, err)
+// GetServiceAccountTokenSecret returns the newest token secret of the ServiceAccount whose token is populated.
+// A NotFound error is returned if there is none.
+func GetServiceAccountTokenSecret(ctx context.Context, client kubeclient.Interface, saObj *corev1.ServiceAccount) (*corev1.Secret, error) {
+	secrets, err := ListServiceAccountTokenSecrets(ctx, client, saObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *corev1.Secret
+	for i := range secrets {
+		secret := &secrets[i]
+		if !isPopulatedTokenSecretOf(secret, saObj) {
+			continue
 		}
-		clusterSecret, err = GetTargetSecret(client, serviceAccount.Secrets, corev1.SecretTypeServiceAccountToken, asObj.Namespace)
-		if err != nil {
-			if apierrors.IsNotFound(err) {
-				return false, nil
-			}
-			return false, err
+		if newest == nil || newest.CreationTimestamp.Before(&secret.CreationTimestamp) {
+			newest = secret
 		}
-
-		return true, nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get serviceAccount secret, error: %v", err)
 	}
-	return clusterSecret, nil
+	if newest == nil {
+		return nil, apierrors.NewNotFound(corev1.Resource("secrets"),
+			fmt.Sprintf("token secret of service account %s/%s", saObj.Namespace, saObj.Name))
+	}
+	return newest, nil
 }
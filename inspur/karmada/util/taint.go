@@ -0,0 +1,242 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	clusterv1alpha1 "ranzhouol/k8s_study/inspur/karmada/cluster/v1alpha1"
+)
+
+const (
+	// MaintenanceTaintKey is the key of the taint added by cordon and drain.
+	MaintenanceTaintKey = "k8s-study.io/maintenance"
+
+	// TaintExpirationsAnnotation records when the taints of a cluster expire, in the form of {"key:effect": "RFC3339 time"}.
+	TaintExpirationsAnnotation = "k8s-study.io/taint-expirations"
+)
+
+// ParseTaint parses a taint in the form of 'key=value:effect' or 'key:effect'.
+func ParseTaint(spec string) (corev1.Taint, error) {
+	var taint corev1.Taint
+
+	index := strings.LastIndex(spec, ":")
+	if index < 0 {
+		return taint, fmt.Errorf("invalid taint spec %q, should be key=value:effect or key:effect", spec)
+	}
+	taint.Effect = corev1.TaintEffect(spec[index+1:])
+	if err := validateTaintEffect(taint.Effect); err != nil {
+		return taint, err
+	}
+
+	keyValue := strings.SplitN(spec[:index], "=", 2)
+	taint.Key = keyValue[0]
+	if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+		return taint, fmt.Errorf("invalid taint key %q: %s", taint.Key, strings.Join(errs, "; "))
+	}
+	if len(keyValue) == 2 {
+		taint.Value = keyValue[1]
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return taint, fmt.Errorf("invalid taint value %q: %s", taint.Value, strings.Join(errs, "; "))
+		}
+	}
+	return taint, nil
+}
+
+func validateTaintEffect(effect corev1.TaintEffect) error {
+	switch effect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		return nil
+	}
+	return fmt.Errorf("invalid taint effect %q, should be one of %s, %s or %s", effect,
+		corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+}
+
+func taintExpirationKey(key string, effect corev1.TaintEffect) string {
+	return fmt.Sprintf("%s:%s", key, effect)
+}
+
+// ListClusterTaints lists the taints of the cluster.
+func ListClusterTaints(ctx context.Context, client *dynamic.DynamicClient, clusterName string) ([]corev1.Taint, error) {
+	cluster, exist, err := GetClusterWithKarmadaClient(ctx, client, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, fmt.Errorf("cluster(%s) is not registered", clusterName)
+	}
+	return cluster.Spec.Taints, nil
+}
+
+// AddClusterTaint adds the taint to the cluster, or updates the value if the taint with the same key and effect exists.
+// If expireAt is not nil, the taint is removed by RemoveExpiredClusterTaints after that time.
+func AddClusterTaint(ctx context.Context, client *dynamic.DynamicClient, clusterName string, taint corev1.Taint, expireAt *time.Time) error {
+	if err := validateTaintEffect(taint.Effect); err != nil {
+		return err
+	}
+	if taint.Effect == corev1.TaintEffectNoExecute && taint.TimeAdded == nil {
+		now := metav1.Now()
+		taint.TimeAdded = &now
+	}
+
+	return updateClusterTaints(ctx, client, clusterName, func(taints []corev1.Taint, expirations map[string]string) []corev1.Taint {
+		expirationKey := taintExpirationKey(taint.Key, taint.Effect)
+		delete(expirations, expirationKey)
+		if expireAt != nil {
+			expirations[expirationKey] = expireAt.UTC().Format(time.RFC3339)
+		}
+
+		for i := range taints {
+			if taints[i].Key == taint.Key && taints[i].Effect == taint.Effect {
+				taints[i] = taint
+				return taints
+			}
+		}
+		return append(taints, taint)
+	})
+}
+
+// RemoveClusterTaint removes the taints with the key from the cluster. If effect is empty, taints of all effects are removed.
+func RemoveClusterTaint(ctx context.Context, client *dynamic.DynamicClient, clusterName, key string, effect corev1.TaintEffect) error {
+	return updateClusterTaints(ctx, client, clusterName, func(taints []corev1.Taint, expirations map[string]string) []corev1.Taint {
+		var remained []corev1.Taint
+		for _, taint := range taints {
+			if taint.Key == key && (effect == "" || taint.Effect == effect) {
+				delete(expirations, taintExpirationKey(taint.Key, taint.Effect))
+				continue
+			}
+			remained = append(remained, taint)
+		}
+		return remained
+	})
+}
+
+// RemoveExpiredClusterTaints removes the taints which are expired at now from all the clusters. The removed
+// taints are returned by cluster name, in the form of key:effect.
+func RemoveExpiredClusterTaints(ctx context.Context, client *dynamic.DynamicClient, now time.Time) (map[string][]string, error) {
+	clusters, err := ListClusters(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := map[string][]string{}
+
+	var errs []error
+	for _, cluster := range clusters {
+		if _, ok := cluster.Annotations[TaintExpirationsAnnotation]; !ok {
+			continue
+		}
+
+		var removedTaints []string
+		err = updateClusterTaints(ctx, client, cluster.Name, func(taints []corev1.Taint, expirations map[string]string) []corev1.Taint {
+			// the taints may be mutated again on conflict.
+			removedTaints = nil
+			var remained []corev1.Taint
+			for _, taint := range taints {
+				expirationKey := taintExpirationKey(taint.Key, taint.Effect)
+				if expireAt, ok := expirations[expirationKey]; ok {
+					if t, err := time.Parse(time.RFC3339, expireAt); err == nil && !now.Before(t) {
+						logrus.Infof("remove expired taint %s from cluster(%s)", expirationKey, cluster.Name)
+						delete(expirations, expirationKey)
+						removedTaints = append(removedTaints, expirationKey)
+						continue
+					}
+				}
+				remained = append(remained, taint)
+			}
+
+			// forget the expirations of the taints which have been removed by others.
+			for expirationKey := range expirations {
+				found := false
+				for _, taint := range remained {
+					if taintExpirationKey(taint.Key, taint.Effect) == expirationKey {
+						found = true
+						break
+					}
+				}
+				if !found {
+					delete(expirations, expirationKey)
+				}
+			}
+			return remained
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove expired taints from cluster(%s), error: %v", cluster.Name, err))
+			continue
+		}
+		if len(removedTaints) > 0 {
+			removed[cluster.Name] = removedTaints
+		}
+	}
+	return removed, utilerrors.NewAggregate(errs)
+}
+
+// updateClusterTaints updates the taints and their expirations of the cluster with a JSON merge patch.
+// The resourceVersion is carried in the patch, so that the update is retried on conflict instead of
+// overwriting the taints changed by others.
+func updateClusterTaints(ctx context.Context, client *dynamic.DynamicClient, clusterName string, mutate func(taints []corev1.Taint, expirations map[string]string) []corev1.Taint) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cluster, exist, err := GetClusterWithKarmadaClient(ctx, client, clusterName)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return fmt.Errorf("cluster(%s) is not registered", clusterName)
+		}
+
+		expirations := map[string]string{}
+		if value, ok := cluster.Annotations[TaintExpirationsAnnotation]; ok {
+			if err = json.Unmarshal([]byte(value), &expirations); err != nil {
+				logrus.Warnf("ignore invalid annotation %s of cluster(%s), error: %v", TaintExpirationsAnnotation, clusterName, err)
+				expirations = map[string]string{}
+			}
+		}
+
+		taints := mutate(append([]corev1.Taint(nil), cluster.Spec.Taints...), expirations)
+		return patchClusterTaints(ctx, client, cluster, taints, expirations)
+	})
+}
+
+func patchClusterTaints(ctx context.Context, client *dynamic.DynamicClient, cluster *clusterv1alpha1.Cluster, taints []corev1.Taint, expirations map[string]string) error {
+	var expirationsValue interface{}
+	if len(expirations) > 0 {
+		expirationsByte, err := json.Marshal(expirations)
+		if err != nil {
+			return err
+		}
+		expirationsValue = string(expirationsByte)
+	}
+	var taintsValue interface{}
+	if len(taints) > 0 {
+		taintsValue = taints
+	}
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": cluster.ResourceVersion,
+			"annotations": map[string]interface{}{
+				TaintExpirationsAnnotation: expirationsValue,
+			},
+		},
+		"spec": map[string]interface{}{
+			"taints": taintsValue,
+		},
+	}
+	patchByte, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Resource(clusterGVR).Patch(ctx, cluster.Name, types.MergePatchType, patchByte, metav1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,95 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+// LoadConfigCAData returns the CA data of the rest config, which is read from CAFile if CAData is empty.
+func LoadConfigCAData(config *rest.Config) ([]byte, error) {
+	if len(config.TLSClientConfig.CAData) > 0 {
+		return config.TLSClientConfig.CAData, nil
+	}
+	if config.TLSClientConfig.CAFile == "" {
+		return nil, nil
+	}
+	caData, err := os.ReadFile(config.TLSClientConfig.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file %s, error: %w", config.TLSClientConfig.CAFile, err)
+	}
+	return caData, nil
+}
+
+// MergeCABundle merges the PEM encoded CA bundles into one, the duplicated certificates are dropped.
+func MergeCABundle(bundles ...[]byte) ([]byte, error) {
+	var merged [][]byte
+	for _, bundle := range bundles {
+		for rest := bundle; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("failed to parse CA certificate, error: %w", err)
+			}
+
+			duplicated := false
+			for _, cert := range merged {
+				if bytes.Equal(cert, block.Bytes) {
+					duplicated = true
+					break
+				}
+			}
+			if !duplicated {
+				merged = append(merged, block.Bytes)
+			}
+		}
+	}
+	if len(merged) == 0 {
+		return nil, fmt.Errorf("no CA certificate found")
+	}
+
+	var buf bytes.Buffer
+	for _, cert := range merged {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// VerifyServingCertificate makes sure the serving certificate chain of the endpoint is trusted by caBundle and
+// its SANs cover the endpoint host, in the same way as karmada control plane connects to the member cluster.
+func VerifyServingCertificate(ctx context.Context, endpoint string, caBundle []byte, proxy *url.URL, proxyHeader map[string]string, timeout time.Duration) error {
+	verifyConfig := &rest.Config{
+		Host: endpoint,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: caBundle,
+		},
+	}
+	if proxy != nil {
+		SetProxy(verifyConfig, proxy, proxyHeader)
+	}
+
+	err := CheckClusterConnectivity(ctx, verifyConfig, timeout)
+	var statusErr apierrors.APIStatus
+	if err == nil || errors.As(err, &statusErr) {
+		// the request is anonymous, any response from apiserver means the TLS handshake succeeded.
+		return nil
+	}
+	return err
+}
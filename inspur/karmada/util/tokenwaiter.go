@@ -0,0 +1,227 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+)
+
+// tokenSecretFieldSelector selects the secrets holding the token of ServiceAccounts.
+var tokenSecretFieldSelector = fmt.Sprintf("type=%s", corev1.SecretTypeServiceAccountToken)
+
+// ServiceAccountSecretWaiter waits for the token secret of a ServiceAccount to be populated by the token
+// controller of the cluster. It watches the token secrets in the namespace of the ServiceAccount, and only
+// polls them one by one with get when listing or watching them is forbidden.
+type ServiceAccountSecretWaiter struct {
+	client       kubeclient.Interface
+	clock        clock.Clock
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+// NewServiceAccountSecretWaiter returns a waiter giving up after timeout.
+func NewServiceAccountSecretWaiter(client kubeclient.Interface, timeout time.Duration) *ServiceAccountSecretWaiter {
+	return &ServiceAccountSecretWaiter{
+		client:       client,
+		clock:        clock.RealClock{},
+		timeout:      timeout,
+		pollInterval: serviceAccountSecretPollInterval,
+	}
+}
+
+// WithClock replaces the clock driving the timeout and the polling of the waiter.
+func (w *ServiceAccountSecretWaiter) WithClock(c clock.Clock) *ServiceAccountSecretWaiter {
+	w.clock = c
+	return w
+}
+
+// Wait returns the first token secret annotated for the ServiceAccount whose token is populated.
+func (w *ServiceAccountSecretWaiter) Wait(ctx context.Context, saObj *corev1.ServiceAccount) (*corev1.Secret, error) {
+	return w.wait(ctx, saObj, "")
+}
+
+// Lookup returns the populated token secret of the ServiceAccount without waiting, found the same way as Wait
+// does. It's nil if the token is not issued yet.
+func (w *ServiceAccountSecretWaiter) Lookup(ctx context.Context, saObj *corev1.ServiceAccount) (*corev1.Secret, error) {
+	secret, _, err := w.list(ctx, saObj, func(*corev1.Secret) bool { return true })
+	if apierrors.IsForbidden(err) {
+		return w.get(ctx, saObj, "")
+	}
+	return secret, err
+}
+
+// WaitForSecret returns the token secret of the ServiceAccount with the name once its token is populated.
+func (w *ServiceAccountSecretWaiter) WaitForSecret(ctx context.Context, saObj *corev1.ServiceAccount, name string) (*corev1.Secret, error) {
+	return w.wait(ctx, saObj, name)
+}
+
+// wait waits for the token secret with the name, or any token secret of the ServiceAccount if name is empty.
+func (w *ServiceAccountSecretWaiter) wait(ctx context.Context, saObj *corev1.ServiceAccount, name string) (*corev1.Secret, error) {
+	match := func(secret *corev1.Secret) bool { return name == "" || secret.Name == name }
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timer := w.clock.NewTimer(w.timeout)
+	defer timer.Stop()
+	timedOut := make(chan struct{})
+	go func() {
+		select {
+		case <-timer.C():
+			close(timedOut)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	secret, err := w.watch(ctx, saObj, match)
+	if apierrors.IsForbidden(err) {
+		logrus.Warnf("listing or watching secrets in namespace %s is forbidden, fall back to polling. error: %v", saObj.Namespace, err)
+		secret, err = w.poll(ctx, saObj, name)
+	}
+	if err != nil {
+		select {
+		case <-timedOut:
+			return nil, fmt.Errorf("timed out waiting for the token secret of service account %s/%s after %v", saObj.Namespace, saObj.Name, w.timeout)
+		default:
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+// watch lists the token secrets, then watches them from the listed resource version until a matched one is
+// populated. It lists again when the watch is closed or expired.
+func (w *ServiceAccountSecretWaiter) watch(ctx context.Context, saObj *corev1.ServiceAccount, match func(*corev1.Secret) bool) (*corev1.Secret, error) {
+	for {
+		secret, resourceVersion, err := w.list(ctx, saObj, match)
+		if err != nil || secret != nil {
+			return secret, err
+		}
+
+		watcher, err := w.client.CoreV1().Secrets(saObj.Namespace).Watch(ctx, metav1.ListOptions{
+			FieldSelector:   tokenSecretFieldSelector,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+		secret, err = receiveTokenSecret(ctx, watcher, saObj, match)
+		watcher.Stop()
+		if err != nil || secret != nil {
+			return secret, err
+		}
+	}
+}
+
+// receiveTokenSecret returns the matched token secret received from watcher. Both are nil if the watch is
+// closed or expired before that.
+func receiveTokenSecret(ctx context.Context, watcher watch.Interface, saObj *corev1.ServiceAccount, match func(*corev1.Secret) bool) (*corev1.Secret, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				secret, ok := event.Object.(*corev1.Secret)
+				if ok && isPopulatedTokenSecretOf(secret, saObj) && match(secret) {
+					return secret, nil
+				}
+			case watch.Error:
+				err := apierrors.FromObject(event.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return nil, nil
+				}
+				return nil, err
+			}
+		}
+	}
+}
+
+// poll gets the token secret with the name, or the token secrets referenced by the ServiceAccount if name is
+// empty, every poll interval until one is populated. Only get is used, as list may be what is forbidden.
+func (w *ServiceAccountSecretWaiter) poll(ctx context.Context, saObj *corev1.ServiceAccount, name string) (*corev1.Secret, error) {
+	for {
+		secret, err := w.get(ctx, saObj, name)
+		if err != nil || secret != nil {
+			return secret, err
+		}
+
+		timer := w.clock.NewTimer(w.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// get returns the populated token secret with the name, or the first populated one referenced by the
+// ServiceAccount if name is empty.
+func (w *ServiceAccountSecretWaiter) get(ctx context.Context, saObj *corev1.ServiceAccount, name string) (*corev1.Secret, error) {
+	names := []string{name}
+	if name == "" {
+		liveSA, err := w.client.CoreV1().ServiceAccounts(saObj.Namespace).Get(ctx, saObj.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		names = names[:0]
+		for _, ref := range liveSA.Secrets {
+			names = append(names, ref.Name)
+		}
+	}
+
+	for _, name := range names {
+		secret, err := w.client.CoreV1().Secrets(saObj.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isPopulatedTokenSecretOf(secret, saObj) {
+			return secret, nil
+		}
+	}
+	return nil, nil
+}
+
+// list returns the matched token secret of the ServiceAccount if it's populated, and the resource version to
+// watch from.
+func (w *ServiceAccountSecretWaiter) list(ctx context.Context, saObj *corev1.ServiceAccount, match func(*corev1.Secret) bool) (*corev1.Secret, string, error) {
+	secretList, err := w.client.CoreV1().Secrets(saObj.Namespace).List(ctx, metav1.ListOptions{FieldSelector: tokenSecretFieldSelector})
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if isPopulatedTokenSecretOf(secret, saObj) && match(secret) {
+			return secret, secretList.ResourceVersion, nil
+		}
+	}
+	return nil, secretList.ResourceVersion, nil
+}
+
+// isPopulatedTokenSecretOf tells if the secret is annotated for the ServiceAccount and holds its token.
+func isPopulatedTokenSecretOf(secret *corev1.Secret, saObj *corev1.ServiceAccount) bool {
+	if secret.Annotations[corev1.ServiceAccountNameKey] != saObj.Name {
+		return false
+	}
+	// a secret left by a deleted ServiceAccount with the same name is not the one.
+	if uid := secret.Annotations[corev1.ServiceAccountUIDKey]; uid != "" && saObj.UID != "" && uid != string(saObj.UID) {
+		return false
+	}
+	return len(secret.Data[corev1.ServiceAccountTokenKey]) > 0
+}
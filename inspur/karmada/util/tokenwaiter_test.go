@@ -0,0 +1,181 @@
+package util
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+const waiterTestTimeout = time.Hour
+
+func newWaiterTestServiceAccount() *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "karmada-cluster", Name: "karmada-member1", UID: "sa-uid"},
+		Secrets:    []corev1.ObjectReference{{Name: "karmada-member1-token-abcde"}},
+	}
+}
+
+func newWaiterTestTokenSecret(sa *corev1.ServiceAccount) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: sa.Namespace,
+			Name:      sa.Secrets[0].Name,
+			Annotations: map[string]string{
+				corev1.ServiceAccountNameKey: sa.Name,
+				corev1.ServiceAccountUIDKey:  string(sa.UID),
+			},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{corev1.ServiceAccountTokenKey: []byte("token")},
+	}
+}
+
+type waitResult struct {
+	secret *corev1.Secret
+	err    error
+}
+
+func startWaiting(waiter *ServiceAccountSecretWaiter, sa *corev1.ServiceAccount) <-chan waitResult {
+	result := make(chan waitResult, 1)
+	go func() {
+		secret, err := waiter.Wait(context.Background(), sa)
+		result <- waitResult{secret: secret, err: err}
+	}()
+	return result
+}
+
+func TestServiceAccountSecretWaiterWatch(t *testing.T) {
+	sa := newWaiterTestServiceAccount()
+	client := fake.NewSimpleClientset(sa)
+	watching := make(chan struct{})
+	client.PrependWatchReactor("secrets", func(clienttesting.Action) (bool, watch.Interface, error) {
+		close(watching)
+		return false, nil, nil
+	})
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	result := startWaiting(NewServiceAccountSecretWaiter(client, waiterTestTimeout).WithClock(fakeClock), sa)
+
+	<-watching
+	// a secret of another ServiceAccount is skipped.
+	other := newWaiterTestTokenSecret(sa)
+	other.Name = "other-token"
+	other.Annotations[corev1.ServiceAccountNameKey] = "other"
+	if _, err := client.CoreV1().Secrets(sa.Namespace).Create(context.TODO(), other, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	tokenSecret := newWaiterTestTokenSecret(sa)
+	if _, err := client.CoreV1().Secrets(sa.Namespace).Create(context.TODO(), tokenSecret, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			t.Fatalf("unexpected error: %v", r.err)
+		}
+		if r.secret.Name != tokenSecret.Name {
+			t.Errorf("expected secret %s, got %s", tokenSecret.Name, r.secret.Name)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("the token secret created after the watch started is not received")
+	}
+}
+
+func TestServiceAccountSecretWaiterTimeout(t *testing.T) {
+	sa := newWaiterTestServiceAccount()
+	client := fake.NewSimpleClientset(sa)
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	result := startWaiting(NewServiceAccountSecretWaiter(client, waiterTestTimeout).WithClock(fakeClock), sa)
+
+	for !fakeClock.HasWaiters() {
+		time.Sleep(time.Millisecond)
+	}
+	fakeClock.Step(waiterTestTimeout)
+
+	select {
+	case r := <-result:
+		if r.err == nil || !strings.Contains(r.err.Error(), "timed out") {
+			t.Fatalf("expected a timeout error, got secret %v and error %v", r.secret, r.err)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("the waiter does not time out")
+	}
+}
+
+func TestServiceAccountSecretWaiterPollFallback(t *testing.T) {
+	sa := newWaiterTestServiceAccount()
+	client := fake.NewSimpleClientset(sa)
+	// only get is allowed on secrets, so the waiter can neither list nor watch them.
+	forbidden := func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", nil)
+	}
+	client.PrependReactor("list", "secrets", forbidden)
+	client.PrependWatchReactor("secrets", func(clienttesting.Action) (bool, watch.Interface, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", nil)
+	})
+	polling := make(chan struct{})
+	var polled bool
+	client.PrependReactor("get", "serviceaccounts", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if !polled {
+			polled = true
+			close(polling)
+		}
+		return false, nil, nil
+	})
+	fakeClock := testingclock.NewFakeClock(time.Now())
+	result := startWaiting(NewServiceAccountSecretWaiter(client, waiterTestTimeout).WithClock(fakeClock), sa)
+
+	<-polling
+	if err := client.Tracker().Add(newWaiterTestTokenSecret(sa)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(wait.ForeverTestTimeout)
+	for {
+		select {
+		case r := <-result:
+			if r.err != nil {
+				t.Fatalf("unexpected error: %v", r.err)
+			}
+			if r.secret.Name != sa.Secrets[0].Name {
+				t.Errorf("expected secret %s, got %s", sa.Secrets[0].Name, r.secret.Name)
+			}
+			return
+		case <-deadline:
+			t.Fatal("the token secret is not polled")
+		case <-time.After(10 * time.Millisecond):
+			fakeClock.Step(serviceAccountSecretPollInterval)
+		}
+	}
+}
+
+func TestServiceAccountSecretWaiterLookup(t *testing.T) {
+	sa := newWaiterTestServiceAccount()
+	client := fake.NewSimpleClientset(sa)
+	waiter := NewServiceAccountSecretWaiter(client, waiterTestTimeout)
+
+	secret, err := waiter.Lookup(context.TODO(), sa)
+	if err != nil || secret != nil {
+		t.Fatalf("expected no token secret before it's issued, got secret %v and error %v", secret, err)
+	}
+	if err = client.Tracker().Add(newWaiterTestTokenSecret(sa)); err != nil {
+		t.Fatal(err)
+	}
+	secret, err = waiter.Lookup(context.TODO(), sa)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secret == nil || secret.Name != sa.Secrets[0].Name {
+		t.Errorf("expected secret %s, got %v", sa.Secrets[0].Name, secret)
+	}
+}